@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/db"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/secrets"
+	"core-regulus-backend/internal/token"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const commandTimeout = 30 * time.Second
+
+const usage = `usage: core-regulus-backend [command]
+
+Without a command the HTTP server is started.
+
+commands:
+  config check            validate the environment and config.config, listing every problem
+  config dump             print the effective configuration and where each value came from
+  secret generate-key     print a new base64 master key for CONFIG_MASTER_KEY
+  secret encrypt <code>   encrypt the JSON value read from stdin and store it in config.config
+  secret rotate [code...] re-wrap encrypted config.config values with the current master key
+  user set-role <id> <role>
+                          make the user a guest, host or admin; a host or admin signs
+                          in with a token from user token
+  user token <id>         print a token with the user's role; host and admin tokens
+                          expire after 12 hours and /user/auth doesn't extend them
+`
+
+// runCommand runs the command named by args and returns its exit code.
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "check":
+		return configCheck(os.Stdout, os.Stderr)
+	case len(args) == 2 && args[0] == "config" && args[1] == "dump":
+		return configDump(os.Stdout, os.Stderr)
+	case len(args) == 2 && args[0] == "secret" && args[1] == "generate-key":
+		return secretGenerateKey(os.Stdout, os.Stderr)
+	case len(args) == 3 && args[0] == "secret" && args[1] == "encrypt":
+		return secretEncrypt(args[2], os.Stdin, os.Stdout, os.Stderr)
+	case len(args) >= 2 && args[0] == "secret" && args[1] == "rotate":
+		return secretRotate(args[2:], os.Stdout, os.Stderr)
+	case len(args) == 4 && args[0] == "user" && args[1] == "set-role":
+		return userSetRole(args[2], args[3], os.Stdout, os.Stderr)
+	case len(args) == 3 && args[0] == "user" && args[1] == "token":
+		return userToken(args[2], os.Stdout, os.Stderr)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func configCheck(stdout, stderr io.Writer) int {
+	cfg, err := config.Load()
+	if err != nil {
+		printConfigErrors(stderr, "environment", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "environment: ok")
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	database, err := db.Open(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	if _, err := database.Settings(ctx); err != nil {
+		printConfigErrors(stderr, "config.config", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "config.config: ok")
+	return 0
+}
+
+func printConfigErrors(w io.Writer, source string, err error) {
+	var errs config.Errors
+	if !errors.As(err, &errs) {
+		fmt.Fprintf(w, "%s: %v\n", source, err)
+		return
+	}
+	fmt.Fprintf(w, "%s: %d problem(s)\n", source, len(errs))
+	for _, fe := range errs {
+		fmt.Fprintf(w, "  %s: %s\n", fe.Key, fe.Message)
+	}
+}
+
+// configDump prints the effective configuration. Secrets are redacted, so the
+// output is safe to paste into an issue. An invalid configuration is still
+// printed as far as it was resolved, followed by its errors.
+func configDump(stdout, stderr io.Writer) int {
+	settings, err := config.LoadSettings()
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	for _, setting := range settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, setting.Value, setting.Source)
+	}
+	w.Flush()
+	if err != nil {
+		printConfigErrors(stderr, "environment", err)
+		return 1
+	}
+	return 0
+}
+
+func secretGenerateKey(stdout, stderr io.Writer) int {
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(stderr, "generate key: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(key))
+	return 0
+}
+
+// openDatabase loads the environment and connects for commands that change config.config.
+func openDatabase(ctx context.Context, stderr io.Writer) (*config.Config, *db.DB, bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		printConfigErrors(stderr, "environment", err)
+		return nil, nil, false
+	}
+	if cfg.Secrets.Keyring == nil {
+		fmt.Fprintln(stderr, "CONFIG_MASTER_KEY is not set")
+		return nil, nil, false
+	}
+	database, err := db.Open(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "database: %v\n", err)
+		return nil, nil, false
+	}
+	return cfg, database, true
+}
+
+// secretEncrypt stores stdin encrypted under code. Input that isn't JSON is
+// stored as a JSON string.
+func secretEncrypt(code string, stdin io.Reader, stdout, stderr io.Writer) int {
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "read value: %v\n", err)
+		return 1
+	}
+	input = bytes.TrimSpace(input)
+	if !json.Valid(input) {
+		input, _ = json.Marshal(string(input))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cfg, database, ok := openDatabase(ctx, stderr)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	envelope, err := cfg.Secrets.Keyring.Encrypt(code, input)
+	if err != nil {
+		fmt.Fprintf(stderr, "encrypt %s: %v\n", code, err)
+		return 1
+	}
+	if err := database.SetConfigValue(ctx, code, envelope.Value()); err != nil {
+		fmt.Fprintf(stderr, "store %s: %v\n", code, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: encrypted with key %s\n", code, envelope.KeyID)
+	return 0
+}
+
+// secretRotate re-wraps the data keys of encrypted values (all of them when
+// codes is empty) with the primary master key. The values themselves are not
+// re-encrypted.
+func secretRotate(codes []string, stdout, stderr io.Writer) int {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cfg, database, ok := openDatabase(ctx, stderr)
+	if !ok {
+		return 1
+	}
+	defer database.Close()
+
+	raw, err := db.LoadConfig(ctx, database.Pool)
+	if err != nil {
+		fmt.Fprintf(stderr, "load config: %v\n", err)
+		return 1
+	}
+	keyring := cfg.Secrets.Keyring
+	failed := false
+	for code, val := range raw {
+		if len(codes) > 0 && !slices.Contains(codes, code) {
+			continue
+		}
+		envelope, ok := secrets.Parse(val)
+		if !ok {
+			continue
+		}
+		if envelope.KeyID == keyring.PrimaryKeyID() {
+			fmt.Fprintf(stdout, "%s: already uses key %s\n", code, envelope.KeyID)
+			continue
+		}
+		rewrapped, err := keyring.Rewrap(envelope)
+		if err == nil {
+			err = database.SetConfigValue(ctx, code, rewrapped.Value())
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", code, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: re-wrapped from key %s to %s\n", code, envelope.KeyID, rewrapped.KeyID)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func userSetRole(id, role string, stdout, stderr io.Writer) int {
+	if !token.ValidRole(role) {
+		fmt.Fprintf(stderr, "unknown role %q, want %s, %s or %s\n", role, token.RoleGuest, token.RoleHost, token.RoleAdmin)
+		return 2
+	}
+	if err := uuid.Validate(id); err != nil {
+		fmt.Fprintf(stderr, "user id %q is not a UUID\n", id)
+		return 2
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		printConfigErrors(stderr, "environment", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	database, err := db.Open(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	user, err := repository.New(database).SetUserRole(ctx, id, role)
+	if errors.Is(err, repository.ErrNotFound) {
+		fmt.Fprintf(stderr, "user %s is not found\n", id)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "set role: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s (%s, %s): %s\n", user.ID, user.Name, user.Email, user.Role)
+	return 0
+}
+
+// userToken signs a token with the stored role of the user. It is how hosts
+// and admins sign in: /user/auth only issues guest tokens to them once their
+// token has expired.
+func userToken(id string, stdout, stderr io.Writer) int {
+	if err := uuid.Validate(id); err != nil {
+		fmt.Fprintf(stderr, "user id %q is not a UUID\n", id)
+		return 2
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		printConfigErrors(stderr, "environment", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	database, err := db.Open(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	user, err := repository.New(database).User(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		fmt.Fprintf(stderr, "user %s is not found\n", id)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "load user: %v\n", err)
+		return 1
+	}
+	tokenString, err := token.NewIssuer(cfg.JWT).GenerateJWT(token.UserTokenData{
+		Id:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Role:  user.Role,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "sign token: %v\n", err)
+		return 1
+	}
+	fmt.Fprintln(stdout, tokenString)
+	return 0
+}
@@ -0,0 +1,48 @@
+// Package admin is the API hosts and admins use to manage the schedule and
+// bookings.
+package admin
+
+import (
+	"core-regulus-backend/internal/auth"
+	"core-regulus-backend/internal/calendar"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/token"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	repo     *repository.Repository
+	calendar *calendar.Provider
+}
+
+func NewHandler(repo *repository.Repository, calendar *calendar.Provider) *Handler {
+	return &Handler{repo: repo, calendar: calendar}
+}
+
+// InitRoutes mounts the admin API under /admin. Hosts may work with bookings;
+// the schedule is reserved for admins.
+func InitRoutes(app *fiber.App, h *Handler, tokens *token.Issuer) {
+	admin := auth.RequireRole(token.RoleAdmin)
+	host := auth.RequireRole(token.RoleHost)
+	g := app.Group("/admin", auth.New(tokens, auth.Required))
+
+	g.Get("/slots", admin, h.getSlotsHandler)
+	g.Post("/slots", admin, h.postSlotHandler)
+	g.Put("/slots/:id", admin, h.putSlotHandler)
+	g.Delete("/slots/:id", admin, h.deleteSlotHandler)
+
+	g.Get("/attendees", admin, h.getAttendeesHandler)
+	g.Post("/attendees", admin, h.postAttendeeHandler)
+	g.Put("/attendees/:email", admin, h.putAttendeeHandler)
+	g.Delete("/attendees/:email", admin, h.deleteAttendeeHandler)
+
+	g.Get("/blackouts", admin, h.getBlackoutsHandler)
+	g.Put("/blackouts/:date", admin, h.putBlackoutHandler)
+	g.Delete("/blackouts/:date", admin, h.deleteBlackoutHandler)
+
+	g.Get("/bookings", host, h.getBookingsHandler)
+	g.Get("/bookings/export.csv", host, h.getBookingsExportHandler)
+	g.Get("/bookings/:id", host, h.getBookingHandler)
+	g.Post("/bookings/:id/cancel", host, h.postCancelBookingHandler)
+}
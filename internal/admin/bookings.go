@@ -0,0 +1,285 @@
+package admin
+
+import (
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/validation"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageSize = 50
+	// maxExportRows caps an export, since the CSV is built in the response
+	// body before it is sent.
+	maxExportRows = 10000
+)
+
+type Booking struct {
+	ID           string         `json:"id"`
+	CreateTime   time.Time      `json:"createTime"`
+	Status       string         `json:"status"`
+	CancelTime   *time.Time     `json:"cancelTime,omitempty"`
+	CancelReason string         `json:"cancelReason,omitempty"`
+	UserID       string         `json:"userId,omitempty"`
+	EventID      string         `json:"eventId,omitempty"`
+	MeetingType  string         `json:"meetingType,omitempty"`
+	TimeStart    time.Time      `json:"timeStart"`
+	TimeEnd      time.Time      `json:"timeEnd"`
+	GuestEmail   string         `json:"guestEmail"`
+	GuestName    string         `json:"guestName,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	Answers      map[string]any `json:"answers"`
+}
+
+type BookingsResponse struct {
+	Bookings []Booking `json:"bookings"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// BookingsQuery filters bookings by meeting date; both dates are inclusive.
+// Pages hold defaultPageSize bookings unless Limit asks for up to 200.
+type BookingsQuery struct {
+	From        string `query:"from" json:"from" validate:"omitempty,datetime=2006-01-02"`
+	To          string `query:"to" json:"to" validate:"omitempty,datetime=2006-01-02"`
+	Status      string `query:"status" json:"status" validate:"omitempty,oneof=confirmed cancelled"`
+	GuestEmail  string `query:"guestEmail" json:"guestEmail" validate:"omitempty,email,max=254"`
+	MeetingType string `query:"meetingType" json:"meetingType" validate:"max=64"`
+	UserID      string `query:"userId" json:"userId" validate:"omitempty,uuid"`
+	Limit       int    `query:"limit" json:"limit" validate:"omitempty,min=1,max=200"`
+	Offset      int    `query:"offset" json:"offset" validate:"min=0"`
+}
+
+type CancelInput struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+func toBooking(b repository.Booking) Booking {
+	answers := b.Answers
+	if answers == nil {
+		answers = map[string]any{}
+	}
+	return Booking{
+		ID:           b.ID,
+		CreateTime:   b.CreateTime,
+		Status:       b.Status,
+		CancelTime:   b.CancelTime,
+		CancelReason: b.CancelReason,
+		UserID:       b.UserID,
+		EventID:      b.EventID,
+		MeetingType:  b.MeetingType,
+		TimeStart:    b.TimeStart,
+		TimeEnd:      b.TimeEnd,
+		GuestEmail:   b.GuestEmail,
+		GuestName:    b.GuestName,
+		Description:  b.Description,
+		Answers:      answers,
+	}
+}
+
+// bookingFilter parses the query string shared by the list and the export.
+func bookingFilter(c *fiber.Ctx) (repository.BookingFilter, error) {
+	var q BookingsQuery
+	if err := c.QueryParser(&q); err != nil {
+		return repository.BookingFilter{}, problem.ErrInvalidBody.WithDetail("Cannot parse query string").Wrap(err)
+	}
+	if errs := validation.Struct(q); len(errs) > 0 {
+		return repository.BookingFilter{}, problem.Validation(errs)
+	}
+
+	f := repository.BookingFilter{
+		Status:      q.Status,
+		GuestEmail:  q.GuestEmail,
+		MeetingType: q.MeetingType,
+		UserID:      q.UserID,
+		Limit:       q.Limit,
+		Offset:      q.Offset,
+	}
+	if q.From != "" {
+		f.From, _ = time.Parse(dateLayout, q.From)
+	}
+	if q.To != "" {
+		to, _ := time.Parse(dateLayout, q.To)
+		f.To = to.AddDate(0, 0, 1)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.To.After(f.From) {
+		return f, problem.Validation([]validation.ErrorResponse{
+			validation.FieldError("to", q.To, "gtefield=from"),
+		})
+	}
+	return f, nil
+}
+
+func (h *Handler) getBookingsHandler(c *fiber.Ctx) error {
+	f, err := bookingFilter(c)
+	if err != nil {
+		return err
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultPageSize
+	}
+
+	bookings, total, err := h.repo.Bookings(c.UserContext(), f)
+	if err != nil {
+		return err
+	}
+	res := BookingsResponse{
+		Bookings: make([]Booking, 0, len(bookings)),
+		Total:    total,
+		Limit:    f.Limit,
+		Offset:   f.Offset,
+	}
+	for _, b := range bookings {
+		res.Bookings = append(res.Bookings, toBooking(b))
+	}
+	return c.JSON(res)
+}
+
+// bookingID reads the :id route parameter.
+func bookingID(c *fiber.Ctx) (string, error) {
+	id := c.Params("id")
+	if errs := validation.Var("id", id, "uuid"); len(errs) > 0 {
+		return "", problem.Validation(errs)
+	}
+	return id, nil
+}
+
+func (h *Handler) getBookingHandler(c *fiber.Ctx) error {
+	id, err := bookingID(c)
+	if err != nil {
+		return err
+	}
+	b, err := h.repo.Booking(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrBookingNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(toBooking(*b))
+}
+
+// postCancelBookingHandler marks the booking cancelled and, before that is
+// committed, deletes the Calendar event, which notifies the guest. If Google
+// fails the booking stays confirmed; if the commit fails after the event is
+// gone, cancelling again succeeds since a missing event counts as cancelled.
+func (h *Handler) postCancelBookingHandler(c *fiber.Ctx) error {
+	id, err := bookingID(c)
+	if err != nil {
+		return err
+	}
+	var in CancelInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&in); err != nil {
+			return problem.ErrInvalidBody.Wrap(err)
+		}
+	}
+	if validationErrors := validation.Struct(in); len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+
+	ctx := c.UserContext()
+	b, err := h.repo.Booking(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrBookingNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if b.Status == repository.BookingCancelled {
+		return ErrBookingCancelled
+	}
+
+	b, err = h.repo.CancelBooking(ctx, id, in.Reason, func(b repository.Booking) error {
+		if b.EventID == "" {
+			return nil
+		}
+		return h.calendar.CancelEvent(ctx, b.EventID)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrBookingCancelled
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(toBooking(*b))
+}
+
+var csvHeader = []string{
+	"id", "status", "time_start", "time_end", "meeting_type",
+	"guest_name", "guest_email", "description", "answers",
+	"event_id", "create_time", "cancel_time", "cancel_reason", "user_id",
+}
+
+// getBookingsExportHandler writes every matching booking as CSV; limit and
+// offset apply if given. Without a limit, more than maxExportRows bookings
+// are refused rather than truncated.
+func (h *Handler) getBookingsExportHandler(c *fiber.Ctx) error {
+	f, err := bookingFilter(c)
+	if err != nil {
+		return err
+	}
+	if f.Limit == 0 {
+		f.Limit = maxExportRows + 1
+	}
+	rowCount := 0
+
+	w := csv.NewWriter(c.Response().BodyWriter())
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+	err = h.repo.EachBooking(c.UserContext(), f, func(b repository.Booking) error {
+		if rowCount++; rowCount > maxExportRows {
+			return ErrExportTooLarge.WithDetail(fmt.Sprintf("more than %d bookings match; narrow the filter", maxExportRows))
+		}
+		answers, _ := json.Marshal(b.Answers)
+		var cancelTime string
+		if b.CancelTime != nil {
+			cancelTime = b.CancelTime.UTC().Format(time.RFC3339)
+		}
+		return w.Write([]string{
+			b.ID,
+			b.Status,
+			b.TimeStart.UTC().Format(time.RFC3339),
+			b.TimeEnd.UTC().Format(time.RFC3339),
+			csvText(b.MeetingType),
+			csvText(b.GuestName),
+			csvText(b.GuestEmail),
+			csvText(b.Description),
+			csvText(string(answers)),
+			b.EventID,
+			b.CreateTime.UTC().Format(time.RFC3339),
+			cancelTime,
+			csvText(b.CancelReason),
+			b.UserID,
+		})
+	})
+	if err != nil {
+		c.Response().ResetBody()
+		return err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="bookings.csv"`)
+	return nil
+}
+
+// csvText keeps guest-supplied text from being evaluated as a formula when
+// the export is opened in a spreadsheet.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"core-regulus-backend/internal/problem"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrSlotNotFound     = problem.New(fiber.StatusNotFound, "slot_not_found", "Time slot is not found")
+	ErrAttendeeNotFound = problem.New(fiber.StatusNotFound, "attendee_not_found", "Attendee is not found")
+	ErrBlackoutNotFound = problem.New(fiber.StatusNotFound, "blackout_not_found", "Blackout date is not found")
+	ErrBookingNotFound  = problem.New(fiber.StatusNotFound, "booking_not_found", "Booking is not found")
+	ErrBookingCancelled = problem.New(fiber.StatusConflict, "booking_cancelled", "Booking is already cancelled")
+	ErrExportTooLarge   = problem.New(fiber.StatusUnprocessableEntity, "export_too_large", "Too many bookings to export")
+)
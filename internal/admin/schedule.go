@@ -0,0 +1,308 @@
+package admin
+
+import (
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/validation"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04"
+)
+
+type Slot struct {
+	ID              string `json:"id"`
+	DayOfWeek       string `json:"dayOfWeek"`
+	TimeStart       string `json:"timeStart"`
+	DurationMinutes int    `json:"durationMinutes"`
+}
+
+type SlotInput struct {
+	DayOfWeek       string `json:"dayOfWeek" validate:"required,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	TimeStart       string `json:"timeStart" validate:"required,datetime=15:04"`
+	DurationMinutes int    `json:"durationMinutes" validate:"required,min=5,max=1440"`
+}
+
+type Attendee struct {
+	Name  string `json:"name" validate:"required,max=200"`
+	Email string `json:"email" validate:"required,email,max=254"`
+}
+
+type AttendeeNameInput struct {
+	Name string `json:"name" validate:"required,max=200"`
+}
+
+type Blackout struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type BlackoutInput struct {
+	Reason string `json:"reason" validate:"max=200"`
+}
+
+func toSlot(s repository.TimeSlot) Slot {
+	return Slot{
+		ID:              s.ID,
+		DayOfWeek:       s.DayOfWeek,
+		TimeStart:       time.Time{}.Add(s.TimeStart).Format(timeLayout),
+		DurationMinutes: int(s.Duration / time.Minute),
+	}
+}
+
+// parseSlot validates in; a slot must end by midnight.
+func parseSlot(in SlotInput) (repository.TimeSlot, []validation.ErrorResponse) {
+	if errs := validation.Struct(in); len(errs) > 0 {
+		return repository.TimeSlot{}, errs
+	}
+	start, _ := time.Parse(timeLayout, in.TimeStart)
+	slot := repository.TimeSlot{
+		DayOfWeek: in.DayOfWeek,
+		TimeStart: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		Duration:  time.Duration(in.DurationMinutes) * time.Minute,
+	}
+	if slot.TimeStart+slot.Duration > 24*time.Hour {
+		return slot, []validation.ErrorResponse{
+			validation.FieldError("durationMinutes", in.DurationMinutes, "sameday"),
+		}
+	}
+	return slot, nil
+}
+
+func overlapError(in SlotInput) error {
+	return problem.Validation([]validation.ErrorResponse{
+		validation.FieldError("timeStart", in.TimeStart, "overlap"),
+	})
+}
+
+func (h *Handler) getSlotsHandler(c *fiber.Ctx) error {
+	slots, err := h.repo.Slots(c.UserContext())
+	if err != nil {
+		return err
+	}
+	res := make([]Slot, 0, len(slots))
+	for _, s := range slots {
+		res = append(res, toSlot(s))
+	}
+	return c.JSON(res)
+}
+
+func (h *Handler) postSlotHandler(c *fiber.Ctx) error {
+	var in SlotInput
+	if err := c.BodyParser(&in); err != nil {
+		return problem.ErrInvalidBody.Wrap(err)
+	}
+	slot, validationErrors := parseSlot(in)
+	if len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+
+	created, err := h.repo.CreateSlot(c.UserContext(), slot)
+	if errors.Is(err, repository.ErrOverlap) {
+		return overlapError(in)
+	}
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(toSlot(*created))
+}
+
+func (h *Handler) putSlotHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if errs := validation.Var("id", id, "uuid"); len(errs) > 0 {
+		return problem.Validation(errs)
+	}
+	var in SlotInput
+	if err := c.BodyParser(&in); err != nil {
+		return problem.ErrInvalidBody.Wrap(err)
+	}
+	slot, validationErrors := parseSlot(in)
+	if len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+	slot.ID = id
+
+	updated, err := h.repo.UpdateSlot(c.UserContext(), slot)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrSlotNotFound
+	case errors.Is(err, repository.ErrOverlap):
+		return overlapError(in)
+	case err != nil:
+		return err
+	}
+	return c.JSON(toSlot(*updated))
+}
+
+func (h *Handler) deleteSlotHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if errs := validation.Var("id", id, "uuid"); len(errs) > 0 {
+		return problem.Validation(errs)
+	}
+	err := h.repo.DeleteSlot(c.UserContext(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSlotNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) getAttendeesHandler(c *fiber.Ctx) error {
+	attendees, err := h.repo.Attendees(c.UserContext())
+	if err != nil {
+		return err
+	}
+	res := make([]Attendee, 0, len(attendees))
+	for _, a := range attendees {
+		res = append(res, Attendee{Name: a.Name, Email: a.Email})
+	}
+	return c.JSON(res)
+}
+
+func (h *Handler) postAttendeeHandler(c *fiber.Ctx) error {
+	var in Attendee
+	if err := c.BodyParser(&in); err != nil {
+		return problem.ErrInvalidBody.Wrap(err)
+	}
+	if validationErrors := validation.Struct(in); len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+
+	err := h.repo.AddAttendee(c.UserContext(), repository.Attendee{Name: in.Name, Email: in.Email})
+	if errors.Is(err, repository.ErrExists) {
+		return problem.Validation([]validation.ErrorResponse{
+			validation.FieldError("email", in.Email, "unique"),
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(in)
+}
+
+// attendeeEmail reads the :email route parameter.
+func attendeeEmail(c *fiber.Ctx) (string, error) {
+	email, err := url.PathUnescape(c.Params("email"))
+	if err != nil {
+		return "", problem.Validation([]validation.ErrorResponse{
+			validation.FieldError("email", c.Params("email"), "email"),
+		})
+	}
+	if errs := validation.Var("email", email, "email"); len(errs) > 0 {
+		return "", problem.Validation(errs)
+	}
+	return email, nil
+}
+
+func (h *Handler) putAttendeeHandler(c *fiber.Ctx) error {
+	email, err := attendeeEmail(c)
+	if err != nil {
+		return err
+	}
+	var in AttendeeNameInput
+	if err := c.BodyParser(&in); err != nil {
+		return problem.ErrInvalidBody.Wrap(err)
+	}
+	if validationErrors := validation.Struct(in); len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+
+	err = h.repo.RenameAttendee(c.UserContext(), email, in.Name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrAttendeeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(Attendee{Name: in.Name, Email: email})
+}
+
+func (h *Handler) deleteAttendeeHandler(c *fiber.Ctx) error {
+	email, err := attendeeEmail(c)
+	if err != nil {
+		return err
+	}
+	err = h.repo.DeleteAttendee(c.UserContext(), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrAttendeeNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// parseDate reads a YYYY-MM-DD value reported as field on failure.
+func parseDate(field, value string) (time.Time, error) {
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return date, problem.Validation([]validation.ErrorResponse{
+			validation.FieldError(field, value, "datetime="+dateLayout),
+		})
+	}
+	return date, nil
+}
+
+// getBlackoutsHandler lists blackout dates from ?from=, today by default.
+func (h *Handler) getBlackoutsHandler(c *fiber.Ctx) error {
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if val := c.Query("from"); val != "" {
+		var err error
+		if from, err = parseDate("from", val); err != nil {
+			return err
+		}
+	}
+	blackouts, err := h.repo.Blackouts(c.UserContext(), from)
+	if err != nil {
+		return err
+	}
+	res := make([]Blackout, 0, len(blackouts))
+	for _, b := range blackouts {
+		res = append(res, Blackout{Date: b.Date.Format(dateLayout), Reason: b.Reason})
+	}
+	return c.JSON(res)
+}
+
+func (h *Handler) putBlackoutHandler(c *fiber.Ctx) error {
+	date, err := parseDate("date", c.Params("date"))
+	if err != nil {
+		return err
+	}
+	var in BlackoutInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&in); err != nil {
+			return problem.ErrInvalidBody.Wrap(err)
+		}
+	}
+	if validationErrors := validation.Struct(in); len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
+
+	if err := h.repo.SetBlackout(c.UserContext(), repository.Blackout{Date: date, Reason: in.Reason}); err != nil {
+		return err
+	}
+	return c.JSON(Blackout{Date: date.Format(dateLayout), Reason: in.Reason})
+}
+
+func (h *Handler) deleteBlackoutHandler(c *fiber.Ctx) error {
+	date, err := parseDate("date", c.Params("date"))
+	if err != nil {
+		return err
+	}
+	err = h.repo.DeleteBlackout(c.UserContext(), date)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrBlackoutNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
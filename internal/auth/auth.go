@@ -0,0 +1,98 @@
+// Package auth authenticates requests by the user token issued by /user/auth
+// and authorizes them by its role.
+package auth
+
+import (
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/token"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Mode says what New does with requests that carry no usable token.
+type Mode int
+
+const (
+	// Required answers 401 unless the request carries a valid token.
+	Required Mode = iota
+	// Optional lets anonymous requests through, but still answers 401 to an
+	// invalid token so the client knows to drop it.
+	Optional
+	// Identify is for /user/auth: expired tokens are accepted, so a returning
+	// visitor keeps their id, and invalid ones are treated as anonymous. The
+	// role of the stored data is only trustworthy if it hasn't expired; see
+	// token.Renew.
+	Identify
+)
+
+const realm = `Bearer realm="core-regulus"`
+
+type userKey struct{}
+
+// BearerToken returns the token from the Authorization header.
+func BearerToken(c *fiber.Ctx) (string, error) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		return "", errors.New("missing Authorization header")
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", errors.New("invalid Authorization header format")
+	}
+	return token, nil
+}
+
+// New validates the bearer token and stores its data for User.
+func New(tokens *token.Issuer, mode Mode) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString, err := BearerToken(c)
+		if err != nil {
+			if mode == Required || mode == Optional && c.Get(fiber.HeaderAuthorization) != "" {
+				c.Set(fiber.HeaderWWWAuthenticate, realm)
+				return problem.ErrUnauthorized.WithDetail(err.Error())
+			}
+			return c.Next()
+		}
+
+		var data *token.UserTokenData
+		if mode == Identify {
+			data, err = tokens.IdentifyJWT(tokenString)
+		} else {
+			data, err = tokens.ValidateJWT(tokenString)
+		}
+		if err != nil {
+			if mode == Identify {
+				return c.Next()
+			}
+			c.Set(fiber.HeaderWWWAuthenticate, realm+`, error="invalid_token"`)
+			return problem.ErrUnauthorized.WithDetail("Invalid token").Wrap(err)
+		}
+		c.Locals(userKey{}, data)
+		return c.Next()
+	}
+}
+
+// User returns the token data stored by New, or nil for anonymous requests.
+func User(c *fiber.Ctx) *token.UserTokenData {
+	data, _ := c.Locals(userKey{}).(*token.UserTokenData)
+	return data
+}
+
+// RequireRole admits requests whose token grants role or a higher one. It
+// runs after New: 401 for anonymous requests, 403 when the role is
+// insufficient.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := User(c)
+		if user == nil {
+			c.Set(fiber.HeaderWWWAuthenticate, realm)
+			return problem.ErrUnauthorized
+		}
+		if !user.HasRole(role) {
+			return problem.ErrForbidden.WithDetail("Requires the " + role + " role")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/token"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newIssuer(t *testing.T) (*token.Issuer, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.NewIssuer(config.JWTConfig{PrivateKey: key, PublicKey: &key.PublicKey}), key
+}
+
+// serve answers 200 with the authenticated user id, or "anonymous".
+func serve(t *testing.T, handlers []fiber.Handler, header string) (int, string, string) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	handlers = append(handlers, func(c *fiber.Ctx) error {
+		if user := User(c); user != nil {
+			return c.SendString(user.Id)
+		}
+		return c.SendString("anonymous")
+	})
+	app.Get("/", handlers...)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set(fiber.HeaderAuthorization, header)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+	return resp.StatusCode, string(body[:n]), resp.Header.Get(fiber.HeaderWWWAuthenticate)
+}
+
+func TestModes(t *testing.T) {
+	tokens, key := newIssuer(t)
+	valid, _ := tokens.GenerateJWT(token.UserTokenData{Id: "valid"})
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"id":   "expired",
+		"role": token.RoleGuest,
+		"exp":  time.Now().Add(-time.Hour).Unix(),
+	}).SignedString(key)
+	expiredAdmin, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"id":   "admin",
+		"role": token.RoleAdmin,
+		"exp":  time.Now().Add(-time.Hour).Unix(),
+	}).SignedString(key)
+
+	tests := []struct {
+		mode   Mode
+		header string
+		status int
+		body   string
+	}{
+		{Required, "Bearer " + valid, 200, "valid"},
+		{Required, "", 401, ""},
+		{Required, "Bearer garbage", 401, ""},
+		{Required, "Bearer " + expired, 401, ""},
+		{Optional, "", 200, "anonymous"},
+		{Optional, "bearer " + valid, 200, "valid"},
+		{Optional, "Basic Zm9vOmJhcg==", 401, ""},
+		{Optional, "Bearer garbage", 401, ""},
+		{Identify, "Bearer " + expired, 200, "expired"},
+		{Identify, "Bearer garbage", 200, "anonymous"},
+		{Identify, "Bearer " + expiredAdmin, 200, "admin"},
+	}
+	for _, tt := range tests {
+		status, body, challenge := serve(t, []fiber.Handler{New(tokens, tt.mode)}, tt.header)
+		if status != tt.status {
+			t.Errorf("mode %d, %q: status %d, want %d", tt.mode, tt.header, status, tt.status)
+			continue
+		}
+		if status == 200 && body != tt.body {
+			t.Errorf("mode %d, %q: user %q, want %q", tt.mode, tt.header, body, tt.body)
+		}
+		if status == 401 && challenge == "" {
+			t.Errorf("mode %d, %q: 401 without WWW-Authenticate", tt.mode, tt.header)
+		}
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tokens, _ := newIssuer(t)
+	host, _ := tokens.GenerateJWT(token.UserTokenData{Id: "host", Role: token.RoleHost})
+	admin, _ := tokens.GenerateJWT(token.UserTokenData{Id: "admin", Role: token.RoleAdmin})
+	guest, _ := tokens.GenerateJWT(token.UserTokenData{Id: "guest"})
+	handlers := []fiber.Handler{New(tokens, Optional), RequireRole(token.RoleHost)}
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{"", 401},
+		{"Bearer " + guest, 403},
+		{"Bearer " + host, 200},
+		{"Bearer " + admin, 200},
+	}
+	for _, tt := range tests {
+		if status, _, _ := serve(t, handlers, tt.header); status != tt.status {
+			t.Errorf("%q: status %d, want %d", tt.header, status, tt.status)
+		}
+	}
+}
+
+// Identify keeps the id of an expired admin token, but the role must not be
+// honoured: RequireRole after it denies the request.
+func TestExpiredAdminTokenGrantsNothing(t *testing.T) {
+	tokens, key := newIssuer(t)
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"id":   "admin",
+		"role": token.RoleAdmin,
+		"exp":  time.Now().Add(-time.Minute).Unix(),
+	}).SignedString(key)
+
+	data, err := tokens.IdentifyJWT(expired)
+	if err != nil || data.Id != "admin" {
+		t.Fatalf("IdentifyJWT: got %+v, %v, want the admin identified", data, err)
+	}
+	if data.HasRole(token.RoleGuest) {
+		t.Error("expired admin token grants the guest role")
+	}
+	handlers := []fiber.Handler{New(tokens, Identify), RequireRole(token.RoleHost)}
+	if status, _, _ := serve(t, handlers, "Bearer "+expired); status != 403 {
+		t.Errorf("expired admin token: status %d, want 403", status)
+	}
+}
@@ -2,20 +2,29 @@ package calendar
 
 import (
 	"context"
+	"core-regulus-backend/internal/auth"
+	"core-regulus-backend/internal/config"
 	"core-regulus-backend/internal/db"
-	"encoding/json"
+	"core-regulus-backend/internal/logging"
+	"core-regulus-backend/internal/metrics"
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/token"
+	"core-regulus-backend/internal/tracing"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	"golang.org/x/oauth2/jwt"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -39,29 +48,66 @@ type FreeSlot struct {
 }
 
 type CalendarDaysInput struct {
-	DateStart string `json:"dateStart"`
-	DateEnd   string `json:"dateEnd"`
+	DateStart string `json:"dateStart" validate:"required,datetime=2006-01-02"`
+	DateEnd   string `json:"dateEnd" validate:"required,datetime=2006-01-02"`
 }
 
-type TimeSlotRecord struct {
-	Id        string        `json:"id"`
-	DayOfWeek string        `json:"dayOfWeek"`
-	TimeStart string        `json:"timeStart"`
-	Duration  time.Duration `json:"duration"`
-	Attendees []Attendee    `json:"attendees"`
+type Client struct {
+	Service    *calendar.Service
+	CalendarId string
+	tokens     oauth2.TokenSource
 }
 
-type Attendee struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+// Provider lazily builds the Calendar API client from config.config and bounds
+// every Google call by the configured timeout.
+type Provider struct {
+	db       *db.DB
+	timeout  time.Duration
+	endpoint string
+	mu       sync.Mutex
+	client   *Client
 }
 
-var calendarService *calendar.Service
-var calendarId string
-var calendarOnce sync.Once
+func NewProvider(database *db.DB, cfg config.GoogleConfig) *Provider {
+	p := &Provider{
+		db:       database,
+		timeout:  cfg.Timeout,
+		endpoint: cfg.Endpoint,
+	}
+	database.Subscribe(p.onConfigChange)
+	return p
+}
 
-func GetFreeSlots(srv *calendar.Service, calendarID string, from, to time.Time, slotLength time.Duration) ([]FreeSlot, error) {
-	ctx := context.Background()
+// onConfigChange rebuilds the client when the calendar or its credentials
+// change. If the new settings are unusable the client is dropped, so handlers
+// answer 503 rather than keep using the old calendar.
+func (p *Provider) onConfigChange(change db.ConfigChange) {
+	if !change.Has(config.RuntimeKeys...) {
+		return
+	}
+	settings, err := config.ParseRuntime(change.New)
+	var client *Client
+	if err == nil {
+		client, err = NewClient(settings, p.endpoint)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.client = nil
+		slog.Error("can't re-create calendar client after config change", "error", err)
+		return
+	}
+	p.client = client
+	slog.Info("calendar client re-created after config change")
+}
+
+func (p *Provider) GetFreeSlots(ctx context.Context, from, to time.Time, slotLength time.Duration) ([]FreeSlot, error) {
+	srv, calendarID, err := p.getService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
 
 	req := &calendar.FreeBusyRequest{
 		TimeMin: from.Format(time.RFC3339),
@@ -71,7 +117,9 @@ func GetFreeSlots(srv *calendar.Service, calendarID string, from, to time.Time,
 		},
 	}
 
+	start := time.Now()
 	resp, err := srv.Freebusy.Query(req).Context(ctx).Do()
+	metrics.ObserveGoogleCall("freebusy.query", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -108,91 +156,105 @@ func GetFreeSlots(srv *calendar.Service, calendarID string, from, to time.Time,
 	return freeSlots, nil
 }
 
-func getTimeSlots(pool *pgxpool.Pool, from, to time.Time) ([]TimeSlot, error) {
-	ctx := context.Background()
-
-	var jsonData []byte
+// filterDays keeps the days between from and to inclusive.
+func filterDays(days []repository.DaySlots, from, to time.Time) []repository.DaySlots {
+	var result []repository.DaySlots
+	for _, day := range days {
+		if day.Date.After(from) && day.Date.Before(to) || day.Date.Equal(from) || day.Date.Equal(to) {
+			result = append(result, day)
+		}
+	}
+	return result
+}
 
-	err := pool.QueryRow(ctx, "select service.get_free_slots($1, $2);", from, to).Scan(&jsonData)
+// NewClient builds a Calendar API client impersonating settings.GoogleCalendarID
+// with the settings.GoogleCalendar service account. A non-empty endpoint
+// replaces the Calendar API base URL.
+func NewClient(settings *config.Runtime, endpoint string) (*Client, error) {
+	calendarId := settings.GoogleCalendarID
+	creds, err := google.JWTConfigFromJSON(settings.GoogleCalendar.JSON, calendar.CalendarScope)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("can't parse Google service account: %w", err)
 	}
 
-	var slots []TimeSlot
-	if err := json.Unmarshal(jsonData, &slots); err != nil {
-		return nil, err
+	// The client outlives any single request, so it is bound to the background context.
+	ctx := context.Background()
+	creds.Subject = calendarId
+	tokens := oauth2.ReuseTokenSource(nil, creds.TokenSource(ctx))
+	httpClient := oauth2.NewClient(ctx, tokens)
+	httpClient.Transport = tracing.Transport(httpClient.Transport)
+
+	opts := []option.ClientOption{option.WithHTTPClient(httpClient)}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
 	}
-
-	var result []TimeSlot
-	for _, slot := range slots {
-		slotDate, err := time.Parse("2006-01-02", slot.Date)
-		if err != nil {
-			continue
-		}
-		if slotDate.After(from) && slotDate.Before(to) || slotDate.Equal(from) || slotDate.Equal(to) {
-			result = append(result, slot)
-		}
+	srv, err := calendar.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't initialize Calendar API client: %w", err)
 	}
-	return result, nil
+	return &Client{
+		Service:    srv,
+		CalendarId: calendarId,
+		tokens:     tokens,
+	}, nil
 }
 
-func getTargetSlot(pool *pgxpool.Pool, from time.Time) (*TimeSlotRecord, error) {
-	ctx := context.Background()
+// Init creates the Calendar API client at startup. On failure the service
+// keeps running: handlers answer 503 and retry initialisation on demand.
+func (p *Provider) Init(ctx context.Context) error {
+	_, err := p.getClient(ctx)
+	return err
+}
 
-	var jsonData []byte
+func (p *Provider) getClient(ctx context.Context) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
 
-	err := pool.QueryRow(ctx, "select service.get_target_slot($1)", from).Scan(&jsonData)
+	settings, err := p.db.Settings(ctx)
 	if err != nil {
-		return nil, err
+		return nil, ErrCalendarUnavailable.Wrap(err)
 	}
-
-	if len(jsonData) == 0 {
-		return nil, fmt.Errorf("slot is not found at %s", from.Format(time.RFC3339))
+	client, err := NewClient(settings, p.endpoint)
+	if err != nil {
+		return nil, ErrCalendarUnavailable.Wrap(err)
 	}
+	p.client = client
+	return p.client, nil
+}
 
-	var slot TimeSlotRecord
-	if err := json.Unmarshal(jsonData, &slot); err != nil {
-		return nil, err
+func (p *Provider) getService(ctx context.Context) (*calendar.Service, string, error) {
+	client, err := p.getClient(ctx)
+	if err != nil {
+		return nil, "", err
 	}
-	return &slot, nil
+	return client.Service, client.CalendarId, nil
 }
 
-func getService() (*calendar.Service, string) {
-	calendarOnce.Do(func() {
-		dbConfig := *db.Config()
-		var ok bool
-		calendarId, ok = dbConfig.GetString("googleCalendarId")
-		if !ok {
-			log.Fatal("googleCalendarId is not in config.config table")
-		}
-
-		var serviceData string
-		serviceData, ok = dbConfig.GetString("googleCalendar")
-		if !ok {
-			log.Fatal("googleCalendar is not in config.config table")
-		}
-
-		var creds *jwt.Config
-		ctx := context.Background()
-
-		creds, err := google.JWTConfigFromJSON([]byte(serviceData), calendar.CalendarScope)
-		if err != nil {
-			log.Fatalf("Can't parse JWT config: %v", err)
-		}
-
-		creds.Subject = calendarId
-		client := creds.Client(ctx)
+// CheckCredentials verifies that the service account can obtain an access token.
+// Tokens are cached, so the check only reaches Google when the token expires.
+func (p *Provider) CheckCredentials(ctx context.Context) error {
+	client, err := p.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = client.tokens.Token()
+	return err
+}
 
-		calendarService, err = calendar.NewService(ctx, option.WithHTTPClient(client))
-		if err != nil {
-			log.Fatalf("Can't initialize Calendar API client: %v", err)
-		}
-	})
-	return calendarService, calendarId
+func (p *Provider) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
 }
 
-func GetBusySlots(srv *calendar.Service, calendarID string, from, to time.Time) ([]FreeSlot, error) {
-	ctx := context.Background()
+func (p *Provider) GetBusySlots(ctx context.Context, from, to time.Time) ([]FreeSlot, error) {
+	srv, calendarID, err := p.getService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
 
 	req := &calendar.FreeBusyRequest{
 		TimeMin: from.Format(time.RFC3339),
@@ -202,7 +264,9 @@ func GetBusySlots(srv *calendar.Service, calendarID string, from, to time.Time)
 		},
 	}
 
+	start := time.Now()
 	resp, err := srv.Freebusy.Query(req).Context(ctx).Do()
+	metrics.ObserveGoogleCall("freebusy.query", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -222,58 +286,55 @@ func GetBusySlots(srv *calendar.Service, calendarID string, from, to time.Time)
 	return busySlots, nil
 }
 
-func postCalendarDaysHandler(c *fiber.Ctx) error {
+type Handler struct {
+	repo     *repository.Repository
+	provider *Provider
+}
+
+func NewHandler(repo *repository.Repository, provider *Provider) *Handler {
+	return &Handler{
+		repo:     repo,
+		provider: provider,
+	}
+}
+
+func (h *Handler) postCalendarDaysHandler(c *fiber.Ctx) error {
 	var tInterval CalendarDaysInput
 
 	if err := c.BodyParser(&tInterval); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON",
-		})
+		return problem.ErrInvalidBody.Wrap(err)
 	}
 
-	calendar, calendarId := getService()
-	from, err := time.Parse("2006-01-02", tInterval.DateStart)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse timeStart",
-		})
+	from, to, validationErrors := validateDaysInput(tInterval)
+	if len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
 	}
 
-	to, err := time.Parse("2006-01-02", tInterval.DateEnd)
+	ctx := c.UserContext()
+	timeSlots, err := h.provider.GetBusySlots(ctx, from, to)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse timeEnd",
-		})
+		return err
 	}
 
-	timeSlots, err := GetBusySlots(calendar, calendarId, from, to)
+	timetable, err := h.repo.FreeSlots(ctx, from, to)
 	if err != nil {
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error": "Cannot get busy slots from calendar",
-		})
-	}
-
-	pool := db.Connect()
-	timetable, dberr := getTimeSlots(pool, from, to)
-	if dberr != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": dberr.Error(),
-		})
+		return err
 	}
 
 	var result []TimeSlot
-	for _, tt := range timetable {
+	for _, day := range filterDays(timetable, from, to) {
 		var slots []Interval
-		for _, ts := range tt.Slots {
-			start, _ := time.Parse("2006-01-02T15:04:05", ts.TimeStart)
-			end, _ := time.Parse("2006-01-02T15:04:05", ts.TimeEnd)
-			if checkTimeSlot(timeSlots, start, end) {
+		for _, slot := range day.Slots {
+			if checkTimeSlot(timeSlots, slot.Start, slot.End) {
 				continue
 			}
-			slots = append(slots, ts)
+			slots = append(slots, Interval{
+				TimeStart: slot.Start.Format(slotLayout),
+				TimeEnd:   slot.End.Format(slotLayout),
+			})
 		}
 		tmSt := TimeSlot{
-			Date:  tt.Date,
+			Date:  day.Date.Format(dateLayout),
 			Slots: slots,
 		}
 		result = append(result, tmSt)
@@ -291,7 +352,7 @@ func checkTimeSlot(busySlots []FreeSlot, start, end time.Time) bool {
 		if start.Equal(tb.TimeStart) || start.Equal(tb.TimeEnd) {
 			return true
 		}
-		
+
 		if start.After(tb.TimeStart) && start.Before(tb.TimeEnd) {
 			return true
 		}
@@ -306,71 +367,139 @@ func checkTimeSlot(busySlots []FreeSlot, start, end time.Time) bool {
 }
 
 type NewEventRequest struct {
-	Time        string `json:"time"`
-	Event       string `json:"eventName"`
-	Email       string `json:"guestEmail"`
-	Name        string `json:"guestName"`
-	Description string `json:"guestDescription,omitempty"`
+	Time        string         `json:"time" validate:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	Event       string         `json:"eventName" validate:"max=200"`
+	Email       string         `json:"guestEmail" validate:"required,email,max=254"`
+	Name        string         `json:"guestName" validate:"required,max=200"`
+	Description string         `json:"guestDescription,omitempty" validate:"max=4000"`
+	MeetingType string         `json:"meetingType,omitempty" validate:"max=64"`
+	Answers     map[string]any `json:"answers,omitempty"`
 }
 
-func CalendarConflictCheck(startTime time.Time, endTime time.Time) error {
-	srv, calendarId := getService()
+func (p *Provider) CalendarConflictCheck(ctx context.Context, startTime time.Time, endTime time.Time) error {
+	srv, calendarId, err := p.getService(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	start := time.Now()
 	conflictCheck, err := calendar.NewEventsService(srv).List(calendarId).
 		TimeMin(startTime.Format(time.RFC3339)).
 		TimeMax(endTime.Format(time.RFC3339)).
 		SingleEvents(true).
 		OrderBy("startTime").
+		Context(ctx).
 		Do()
-
+	metrics.ObserveGoogleCall("events.list", start, err)
 	if err != nil {
-		return err
+		return ErrCalendarUnavailable.Wrap(err)
 	}
 
 	if len(conflictCheck.Items) > 0 {
-		return errors.New("slot is busy; please choose another slot")
+		return ErrSlotBusy
+	}
+
+	return nil
+}
+
+func (p *Provider) insertEvent(ctx context.Context, event *calendar.Event) (*calendar.Event, error) {
+	srv, calendarId, err := p.getService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	createdEvent, err := calendar.NewEventsService(srv).Insert(calendarId, event).
+		SendUpdates("all").
+		ConferenceDataVersion(1).
+		Context(ctx).
+		Do()
+	metrics.ObserveGoogleCall("events.insert", start, err)
+	if err != nil {
+		return nil, ErrCalendarUnavailable.WithDetail("Unable to set up meeting").Wrap(err)
+	}
+	return createdEvent, nil
+}
+
+// CancelEvent deletes a booked event and notifies its attendees. An event that
+// is already gone is not an error.
+func (p *Provider) CancelEvent(ctx context.Context, eventID string) error {
+	srv, calendarId, err := p.getService(ctx)
+	if err != nil {
+		return err
 	}
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
 
+	start := time.Now()
+	err = calendar.NewEventsService(srv).Delete(calendarId, eventID).
+		SendUpdates("all").
+		Context(ctx).
+		Do()
+	metrics.ObserveGoogleCall("events.delete", start, err)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone) {
+		return nil
+	}
+	if err != nil {
+		return ErrCalendarUnavailable.WithDetail("Unable to cancel meeting").Wrap(err)
+	}
 	return nil
 }
 
-func postCalendarEventHandler(c *fiber.Ctx) error {
+func (h *Handler) postCalendarEventHandler(c *fiber.Ctx) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.BookingFailed(problem.From(err).Code)
+		} else {
+			metrics.BookingSucceeded()
+		}
+	}()
+
 	var eventRequest NewEventRequest
 
 	if err := c.BodyParser(&eventRequest); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON",
-		})
+		return problem.ErrInvalidBody.Wrap(err)
 	}
 
-	srv, calendarId := getService()
+	startTime, validationErrors := validateEventRequest(eventRequest)
+	if len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
+	}
 
-	startTime, err := time.Parse(time.RFC3339, eventRequest.Time)
+	ctx := c.UserContext()
+	tsr, err := h.repo.TargetSlot(ctx, startTime)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrSlotNotFound.WithDetail(fmt.Sprintf("no slot starts at %s", startTime.Format(time.RFC3339)))
+	}
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid time format",
-		})
+		return err
+	}
+	attendees, err := h.repo.Attendees(ctx)
+	if err != nil {
+		return err
 	}
-	pool := db.Connect()
-	tsr, err := getTargetSlot(pool, startTime)
-	if tsr == nil {
+
+	var meetingType *MeetingType
+	answers := map[string]any{}
+	if eventRequest.MeetingType != "" {
+		meetingType, err = h.getMeetingType(ctx, eventRequest.MeetingType)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":  "Time Slot Error",
-				"reason": err.Error(),
-			})
+			return err
+		}
+		answers, validationErrors = validateAnswers(meetingType, eventRequest.Answers)
+		if len(validationErrors) > 0 {
+			return problem.Validation(validationErrors)
 		}
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Time Slot is not found",
-		})
 	}
 
-	endTime := startTime.Add(tsr.Duration * time.Second)
-	err = CalendarConflictCheck(startTime, endTime)
+	endTime := startTime.Add(tsr.Duration)
+	err = h.provider.CalendarConflictCheck(ctx, startTime, endTime)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":  "Slot is busy",
-			"reason": err.Error(),
-		})
+		return err
 	}
 
 	var eventAttendees []*calendar.EventAttendee
@@ -382,16 +511,23 @@ func postCalendarEventHandler(c *fiber.Ctx) error {
 		},
 	)
 
-	for _, a := range tsr.Attendees {
+	for _, a := range attendees {
 		eventAttendees = append(eventAttendees, &calendar.EventAttendee{
 			Email:       a.Email,
 			DisplayName: a.Name,
 		})
 	}
 
+	description := eventRequest.Description
+	if meetingType != nil {
+		if rendered := renderAnswers(meetingType, answers); rendered != "" {
+			description = strings.TrimSpace(description + "\n\n" + rendered)
+		}
+	}
+
 	event := &calendar.Event{
 		Summary:     eventRequest.Name,
-		Description: eventRequest.Description,
+		Description: description,
 		Status:      "tentative",
 		Start: &calendar.EventDateTime{
 			DateTime: startTime.Format(time.RFC3339),
@@ -409,20 +545,49 @@ func postCalendarEventHandler(c *fiber.Ctx) error {
 		},
 	}
 
-	res := calendar.NewEventsService(srv).Insert(calendarId, event).SendUpdates("all").ConferenceDataVersion(1)
-	createdEvent, err := res.Do()
+	createdEvent, err := h.provider.insertEvent(ctx, event)
 	if err != nil {
-		log.Printf("Google API error: %#v", err)
-		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-			"error":  "Unable to set up meeting",
-			"reason": err.Error(),
-		})
+		return err
+	}
+
+	var userID string
+	if user := auth.User(c); user != nil {
+		userID = user.Id
+	}
+	// The event already exists in Google, so record it even if the request
+	// deadline has passed in the meantime.
+	_, err = h.repo.AddBooking(context.WithoutCancel(ctx), repository.Booking{
+		EventID:     createdEvent.Id,
+		MeetingType: eventRequest.MeetingType,
+		TimeStart:   startTime,
+		TimeEnd:     endTime,
+		GuestEmail:  eventRequest.Email,
+		GuestName:   eventRequest.Name,
+		Description: eventRequest.Description,
+		Answers:     answers,
+		UserID:      userID,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("can't store booking", "eventId", createdEvent.Id, "guestEmail", eventRequest.Email, "error", err)
 	}
 
 	return c.JSON(createdEvent)
 }
 
-func InitRoutes(app *fiber.App) {
-	app.Post("/calendar/days", postCalendarDaysHandler)
-	app.Post("/calendar/event", postCalendarEventHandler)
+// InitRoutes mounts the booking API. Booking works anonymously; a signed-in
+// user's bookings are linked to them.
+// getMeetingTypeHandler returns a meeting type with its questions, so the site
+// can build the booking form that /calendar/event validates answers against.
+func (h *Handler) getMeetingTypeHandler(c *fiber.Ctx) error {
+	meetingType, err := h.getMeetingType(c.UserContext(), c.Params("code"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(meetingType)
+}
+
+func InitRoutes(app *fiber.App, h *Handler, tokens *token.Issuer) {
+	app.Post("/calendar/days", h.postCalendarDaysHandler)
+	app.Get("/calendar/meeting-types/:code", h.getMeetingTypeHandler)
+	app.Post("/calendar/event", auth.New(tokens, auth.Optional), h.postCalendarEventHandler)
 }
@@ -0,0 +1,14 @@
+package calendar
+
+import (
+	"core-regulus-backend/internal/problem"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrSlotNotFound        = problem.New(fiber.StatusNotFound, "slot_not_found", "Time slot is not found")
+	ErrSlotBusy            = problem.New(fiber.StatusConflict, "slot_busy", "Slot is busy; please choose another slot")
+	ErrMeetingTypeNotFound = problem.New(fiber.StatusNotFound, "meeting_type_not_found", "Meeting type is not found")
+	ErrCalendarUnavailable = problem.New(fiber.StatusServiceUnavailable, "calendar_unavailable", "Calendar service is unavailable")
+)
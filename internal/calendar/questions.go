@@ -0,0 +1,169 @@
+package calendar
+
+import (
+	"context"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/validation"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	QuestionText     = "text"
+	QuestionSelect   = "select"
+	QuestionCheckbox = "checkbox"
+	QuestionPhone    = "phone"
+	QuestionURL      = "url"
+)
+
+type Question struct {
+	Code     string   `json:"code"`
+	Label    string   `json:"label"`
+	Kind     string   `json:"kind"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+	Rules    string   `json:"rules"`
+}
+
+type MeetingType struct {
+	Code      string     `json:"code"`
+	Name      string     `json:"name"`
+	Questions []Question `json:"questions"`
+}
+
+func (h *Handler) getMeetingType(ctx context.Context, code string) (*MeetingType, error) {
+	mt, err := h.repo.MeetingType(ctx, code)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrMeetingTypeNotFound.WithDetail(fmt.Sprintf("meeting type %s is not defined", code))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MeetingType{Code: mt.Code, Name: mt.Name, Questions: []Question{}}
+	for _, q := range mt.Questions {
+		question := Question{
+			Code:     q.Code,
+			Label:    q.Label,
+			Kind:     q.Kind,
+			Required: q.Required,
+			Options:  q.Options,
+			Rules:    q.Rules,
+		}
+		if err := question.checkRules(); err != nil {
+			return nil, fmt.Errorf("meeting type %s, question %s: %w", mt.Code, q.Code, err)
+		}
+		res.Questions = append(res.Questions, question)
+	}
+	return res, nil
+}
+
+// checkRules rejects rules the validator can't apply to answers of this kind.
+func (q Question) checkRules() error {
+	if q.Rules == "" {
+		return nil
+	}
+	var sample any = ""
+	if q.Kind == QuestionCheckbox {
+		sample = false
+	}
+	return validation.Rules(q.Rules, sample)
+}
+
+func (q Question) tag() string {
+	var tags []string
+	if q.Required {
+		tags = append(tags, "required")
+	} else {
+		tags = append(tags, "omitempty")
+	}
+	switch q.Kind {
+	case QuestionPhone:
+		tags = append(tags, "e164")
+	case QuestionURL:
+		tags = append(tags, "url")
+	}
+	if q.Rules != "" {
+		tags = append(tags, q.Rules)
+	}
+	return strings.Join(tags, ",")
+}
+
+func (q Question) normalize(value any) (any, bool) {
+	if q.Kind == QuestionCheckbox {
+		if value == nil {
+			return false, true
+		}
+		v, ok := value.(bool)
+		return v, ok
+	}
+	if value == nil {
+		return "", true
+	}
+	v, ok := value.(string)
+	return strings.TrimSpace(v), ok
+}
+
+// validateAnswers checks guest answers against the questions of the meeting type
+// and returns them normalized, keyed by question code.
+func validateAnswers(meetingType *MeetingType, answers map[string]any) (map[string]any, []validation.ErrorResponse) {
+	result := map[string]any{}
+	var validationErrors []validation.ErrorResponse
+
+	fail := func(q Question, value any, tag string) {
+		validationErrors = append(validationErrors, validation.FieldError("answers."+q.Code, value, tag))
+	}
+
+	for _, q := range meetingType.Questions {
+		raw := answers[q.Code]
+		value, ok := q.normalize(raw)
+		if !ok {
+			fail(q, raw, q.Kind)
+			continue
+		}
+
+		if errs := validation.Var("answers."+q.Code, value, q.tag()); len(errs) > 0 {
+			validationErrors = append(validationErrors, errs...)
+			continue
+		}
+
+		if q.Kind == QuestionSelect && value != "" && !slices.Contains(q.Options, value.(string)) {
+			fail(q, value, "oneof")
+			continue
+		}
+
+		if value != "" {
+			result[q.Code] = value
+		}
+	}
+
+	for code, value := range answers {
+		if !slices.ContainsFunc(meetingType.Questions, func(q Question) bool { return q.Code == code }) {
+			validationErrors = append(validationErrors, validation.FieldError("answers."+code, value, "unknown"))
+		}
+	}
+
+	return result, validationErrors
+}
+
+func renderAnswers(meetingType *MeetingType, answers map[string]any) string {
+	var sb strings.Builder
+	for _, q := range meetingType.Questions {
+		value, ok := answers[q.Code]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case bool:
+			if v {
+				value = "Yes"
+			} else {
+				value = "No"
+			}
+		}
+		fmt.Fprintf(&sb, "%s\n%v\n\n", q.Label, value)
+	}
+	return strings.TrimSpace(sb.String())
+}
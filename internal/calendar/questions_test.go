@@ -0,0 +1,55 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		q     Question
+		valid bool
+	}{
+		{"no rules", Question{Kind: QuestionText}, true},
+		{"length", Question{Kind: QuestionText, Rules: "min=2,max=100"}, true},
+		{"alternatives", Question{Kind: QuestionText, Rules: "email|url"}, true},
+		{"checkbox", Question{Kind: QuestionCheckbox, Rules: "eq=true"}, true},
+		{"unknown tag", Question{Kind: QuestionText, Rules: "shout"}, false},
+		{"bad parameter", Question{Kind: QuestionText, Rules: "min=two"}, false},
+		{"parameter for another kind", Question{Kind: QuestionCheckbox, Rules: "eq=yes"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.q.checkRules(); (err == nil) != tt.valid {
+			t.Errorf("%s: checkRules() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateAnswersWithBadRulesDoesNotPanic(t *testing.T) {
+	meetingType := &MeetingType{Code: "intro", Questions: []Question{
+		{Code: "company", Kind: QuestionText, Required: true, Rules: "shout"},
+	}}
+	_, errs := validateAnswers(meetingType, map[string]any{"company": "Acme"})
+	if len(errs) != 1 || errs[0].FailedField != "answers.company" || errs[0].Tag != "rules" {
+		t.Errorf("errors = %+v, want a failed rules check on answers.company", errs)
+	}
+}
+
+func TestAnswersRequireMeetingType(t *testing.T) {
+	req := NewEventRequest{
+		Time:    time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		Email:   "guest@example.com",
+		Name:    "Guest",
+		Answers: map[string]any{"company": "Acme"},
+	}
+	_, errs := validateEventRequest(req)
+	if len(errs) != 1 || errs[0].FailedField != "answers" {
+		t.Fatalf("errors = %+v, want answers to be rejected without a meeting type", errs)
+	}
+
+	req.MeetingType = "intro"
+	if _, errs := validateEventRequest(req); len(errs) > 0 {
+		t.Errorf("errors = %+v with a meeting type", errs)
+	}
+}
@@ -0,0 +1,62 @@
+package calendar
+
+import (
+	"core-regulus-backend/internal/validation"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// slotLayout is how slot times are sent to the site: schedule-local, without offset.
+	slotLayout = "2006-01-02T15:04:05"
+
+	MaxDaysRange   = 62
+	BookingHorizon = 365 * 24 * time.Hour
+)
+
+func validateDaysInput(in CalendarDaysInput) (time.Time, time.Time, []validation.ErrorResponse) {
+	if errs := validation.Struct(in); len(errs) > 0 {
+		return time.Time{}, time.Time{}, errs
+	}
+
+	from, _ := time.Parse(dateLayout, in.DateStart)
+	to, _ := time.Parse(dateLayout, in.DateEnd)
+
+	if to.Before(from) {
+		return from, to, []validation.ErrorResponse{
+			validation.FieldError("dateEnd", in.DateEnd, "gtefield=dateStart"),
+		}
+	}
+	if to.Sub(from) > MaxDaysRange*24*time.Hour {
+		return from, to, []validation.ErrorResponse{
+			validation.FieldError("dateEnd", in.DateEnd, "maxrange"),
+		}
+	}
+	return from, to, nil
+}
+
+func validateEventRequest(req NewEventRequest) (time.Time, []validation.ErrorResponse) {
+	if errs := validation.Struct(req); len(errs) > 0 {
+		return time.Time{}, errs
+	}
+	if len(req.Answers) > 0 && req.MeetingType == "" {
+		return time.Time{}, []validation.ErrorResponse{
+			validation.FieldError("answers", req.Answers, "excluded_without=meetingType"),
+		}
+	}
+
+	startTime, _ := time.Parse(time.RFC3339, req.Time)
+
+	now := time.Now()
+	if !startTime.After(now) {
+		return startTime, []validation.ErrorResponse{
+			validation.FieldError("time", req.Time, "future"),
+		}
+	}
+	if startTime.After(now.Add(BookingHorizon)) {
+		return startTime, []validation.ErrorResponse{
+			validation.FieldError("time", req.Time, "horizon"),
+		}
+	}
+	return startTime, nil
+}
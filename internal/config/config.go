@@ -1,111 +1,310 @@
 package config
 
 import (
+	"core-regulus-backend/internal/logging"
+	"core-regulus-backend/internal/secrets"
 	"crypto/rsa"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/joho/godotenv"
 )
 
 type SSHConfig struct {
-	PrivateKey string
-	Host string
-	Port int
-	User string
+	PrivateKey           string
+	PrivateKeyPassphrase string
+	Host                 string
+	Port                 int
+	User                 string
+	// HostKey pins the server key, either as a SHA256 fingerprint or in
+	// authorized_keys format. When empty KnownHostsFile is used.
+	HostKey        string
+	KnownHostsFile string
+	AgentSocket    string
 }
 
 type JWTConfig struct {
 	PrivateKey *rsa.PrivateKey
-	PublicKey *rsa.PublicKey
+	PublicKey  *rsa.PublicKey
 }
 
 type DatabaseConfig struct {
+	Host         string
+	Port         int
+	Name         string
+	User         string
+	Password     string
+	QueryTimeout time.Duration
+
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	ApplicationName  string
+	StatementTimeout time.Duration
+	ConnectTimeout   time.Duration
+
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+
+	// Replicas receive read-only calls; they share credentials and TLS
+	// settings with the primary.
+	Replicas []HostPort
+}
+
+type HostPort struct {
 	Host string
 	Port int
-	Name string
-	User string
-	Password string	
+}
+
+type ServerConfig struct {
+	Address string
+	// MetricsAddress serves /metrics apart from the public API; empty
+	// disables it.
+	MetricsAddress  string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	RequestTimeout  time.Duration
+}
+
+type GoogleConfig struct {
+	Timeout time.Duration
+	// Endpoint overrides the Calendar API base URL; empty means Google's.
+	Endpoint string
+}
+
+type LogConfig struct {
+	Level  slog.Level
+	Format string
+}
+
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
+// SecretsConfig holds the master keys for encrypted config.config values.
+// Keyring is nil when no master key is configured.
+type SecretsConfig struct {
+	Keyring *secrets.Keyring
 }
 
 type Config struct {
 	Environment string
-	SSH SSHConfig
-	Database DatabaseConfig
-	JWT JWTConfig
+	Server      ServerConfig
+	Log         LogConfig
+	Tracing     TracingConfig
+	SSH         SSHConfig
+	Database    DatabaseConfig
+	Google      GoogleConfig
+	JWT         JWTConfig
+	Secrets     SecretsConfig
 }
 
 func (c Config) IsLocal() bool {
 	return c.Environment == "local"
 }
 
-var cfg Config
-var once sync.Once
+func (cfg *Config) loadSSHConfig(env *loader) {
+	cfg.SSH.PrivateKey = strings.ReplaceAll(env.get("SSH_PRIVATE_KEY", ""), `\n`, "\n")
+	cfg.SSH.PrivateKeyPassphrase = env.get("SSH_PRIVATE_KEY_PASSPHRASE", "")
+	cfg.SSH.AgentSocket = env.get("SSH_AUTH_SOCK", "")
+	if cfg.SSH.PrivateKey == "" && cfg.SSH.AgentSocket == "" {
+		env.invalid("SSH_PRIVATE_KEY", "is required when no SSH agent is available (SSH_AUTH_SOCK)")
+	}
+	cfg.SSH.Host = env.require("SSH_HOST")
+	cfg.SSH.Port = env.port("SSH_PORT")
+	cfg.SSH.User = env.require("SSH_USER")
+
+	cfg.SSH.HostKey = env.get("SSH_HOST_KEY", "")
+	defaultKnownHosts := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		defaultKnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	cfg.SSH.KnownHostsFile = env.get("SSH_KNOWN_HOSTS", defaultKnownHosts)
+	if cfg.SSH.HostKey == "" {
+		if _, err := os.Stat(cfg.SSH.KnownHostsFile); err != nil {
+			env.invalid("SSH_HOST_KEY", "is required when there is no known_hosts file (SSH_KNOWN_HOSTS)")
+		}
+	}
+}
+
+func (cfg *Config) loadDatabaseConfig(env *loader) {
+	cfg.Database.Port = env.port("DB_PORT")
+	cfg.Database.User = env.require("DB_USER")
+	cfg.Database.Password = env.require("DB_PASSWORD")
+	cfg.Database.Name = env.require("DB_NAME")
+	cfg.Database.Host = env.require("DB_HOST")
+	cfg.Database.QueryTimeout = env.duration("DB_QUERY_TIMEOUT", 5*time.Second)
+
+	cfg.Database.SSLMode = env.oneOf("DB_SSLMODE", "disable",
+		"disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	cfg.Database.SSLRootCert = env.get("DB_SSLROOTCERT", "")
+	cfg.Database.SSLCert = env.get("DB_SSLCERT", "")
+	cfg.Database.SSLKey = env.get("DB_SSLKEY", "")
+	if (cfg.Database.SSLCert == "") != (cfg.Database.SSLKey == "") {
+		env.invalid("DB_SSLCERT", "must be set together with DB_SSLKEY")
+	}
+
+	cfg.Database.ApplicationName = env.get("DB_APPLICATION_NAME", "core-regulus-backend")
+	cfg.Database.StatementTimeout = env.duration("DB_STATEMENT_TIMEOUT", 30*time.Second)
+	cfg.Database.ConnectTimeout = env.duration("DB_CONNECT_TIMEOUT", 30*time.Second)
 
-func getEnvironment() string {
-	env := os.Getenv("ENVIRONMENT")
-	if (env != "") {
-		return env
+	cfg.Database.MaxConns = env.int("DB_POOL_MAX_CONNS", 10, 1)
+	cfg.Database.MinConns = env.int("DB_POOL_MIN_CONNS", 0, 0)
+	if cfg.Database.MinConns > cfg.Database.MaxConns {
+		env.invalid("DB_POOL_MIN_CONNS", "must not exceed DB_POOL_MAX_CONNS")
 	}
-	return "local"	
+	cfg.Database.MaxConnLifetime = env.duration("DB_POOL_MAX_CONN_LIFETIME", time.Hour)
+	cfg.Database.MaxConnIdleTime = env.duration("DB_POOL_MAX_CONN_IDLE_TIME", 30*time.Minute)
+	cfg.Database.Replicas = env.hostPorts("DB_REPLICA_HOSTS", cfg.Database.Port)
 }
 
-func loadSSHConfig() {
-	cfg.SSH.PrivateKey = strings.ReplaceAll(mustEnv("SSH_PRIVATE_KEY"), `\n`, "\n")
-	cfg.SSH.Host = mustEnv("SSH_HOST")
-	cfg.SSH.Port,_ = strconv.Atoi(mustEnv("SSH_PORT"))
-	cfg.SSH.User = mustEnv("SSH_USER")
+func (cfg *Config) loadServerConfig(env *loader) {
+	cfg.Server.Address = env.get("LISTEN_ADDR", ":5000")
+	cfg.Server.MetricsAddress = env.get("METRICS_ADDR", ":9090")
+	cfg.Server.ReadTimeout = env.duration("HTTP_READ_TIMEOUT", 10*time.Second)
+	cfg.Server.WriteTimeout = env.duration("HTTP_WRITE_TIMEOUT", 30*time.Second)
+	cfg.Server.IdleTimeout = env.duration("HTTP_IDLE_TIMEOUT", 60*time.Second)
+	cfg.Server.ShutdownTimeout = env.duration("HTTP_SHUTDOWN_TIMEOUT", 25*time.Second)
+	cfg.Server.RequestTimeout = env.duration("HTTP_REQUEST_TIMEOUT", 20*time.Second)
 }
 
-func loadDatabaseConfig() {	
-	cfg.Database.Port,_ = strconv.Atoi(mustEnv("DB_PORT"))
-	cfg.Database.User = mustEnv("DB_USER")
-	cfg.Database.Password = mustEnv("DB_PASSWORD")
-	cfg.Database.Name = mustEnv("DB_NAME")
-	cfg.Database.Host = mustEnv("DB_HOST")
+func (cfg *Config) loadGoogleConfig(env *loader) {
+	cfg.Google.Timeout = env.duration("GOOGLE_API_TIMEOUT", 10*time.Second)
+	cfg.Google.Endpoint = env.get("GOOGLE_CALENDAR_ENDPOINT", "")
 }
 
-func loadJWTConfig() {
-	privateKey := strings.ReplaceAll(mustEnv("JWT_PRIVATE_KEY"), `\n`, "\n")
-	publicKey := strings.ReplaceAll(mustEnv("JWT_PUBLIC_KEY"), `\n`, "\n")
+func (cfg *Config) loadLogConfig(env *loader) {
+	if err := cfg.Log.Level.UnmarshalText([]byte(env.get("LOG_LEVEL", "info"))); err != nil {
+		env.invalid("LOG_LEVEL", "must be one of debug, info, warn, error")
+	}
+	defaultFormat := "json"
+	if cfg.IsLocal() {
+		defaultFormat = "text"
+	}
+	cfg.Log.Format = env.oneOf("LOG_FORMAT", defaultFormat, "json", "text")
+}
 
-	var privateKeyErr error
-	cfg.JWT.PrivateKey, privateKeyErr = jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
-	if privateKeyErr != nil {
-		log.Fatalf("Can't decode private key %v", privateKeyErr)
+func (cfg *Config) loadTracingConfig(env *loader) {
+	cfg.Tracing.Endpoint = env.get("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if base := env.get("OTEL_EXPORTER_OTLP_ENDPOINT", ""); cfg.Tracing.Endpoint == "" && base != "" {
+		cfg.Tracing.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	cfg.Tracing.ServiceName = env.get("OTEL_SERVICE_NAME", "core-regulus-backend")
+	cfg.Tracing.SampleRatio = 1
+	if val := env.get("OTEL_TRACES_SAMPLER_ARG", ""); val != "" {
+		ratio, err := strconv.ParseFloat(val, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			env.invalid("OTEL_TRACES_SAMPLER_ARG", "must be a number between 0 and 1")
+		}
+		cfg.Tracing.SampleRatio = ratio
 	}
-	var publicKeyErr error
-	cfg.JWT.PublicKey, publicKeyErr = jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
-	if publicKeyErr != nil {
-		log.Fatalf("Can't decode public key %v", publicKeyErr)
-	}			
 }
 
-func loadConfig() {
-	cfg.Environment = getEnvironment();
-	if (cfg.IsLocal()) {
-		godotenv.Load(".env")	
-		loadSSHConfig()		
+func (cfg *Config) loadJWTConfig(env *loader) {
+	privateKey := strings.ReplaceAll(env.require("JWT_PRIVATE_KEY"), `\n`, "\n")
+	publicKey := strings.ReplaceAll(env.require("JWT_PUBLIC_KEY"), `\n`, "\n")
+
+	var err error
+	if privateKey != "" {
+		cfg.JWT.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+		if err != nil {
+			env.invalid("JWT_PRIVATE_KEY", "can't decode RSA private key: "+err.Error())
+		}
+	}
+	if publicKey != "" {
+		cfg.JWT.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+		if err != nil {
+			env.invalid("JWT_PUBLIC_KEY", "can't decode RSA public key: "+err.Error())
+		}
 	}
-	loadDatabaseConfig()			
-	loadJWTConfig()
 }
 
-func Get() *Config {
-	once.Do(func() {
-		loadConfig()
-	})
-	return &cfg
+func (cfg *Config) loadSecretsConfig(env *loader) {
+	masterKey := strings.TrimSpace(env.get("CONFIG_MASTER_KEY", ""))
+	if masterKey == "" {
+		return
+	}
+	primary, ok := env.key("CONFIG_MASTER_KEY", masterKey)
+	if !ok {
+		return
+	}
+	var previous [][]byte
+	for _, val := range strings.Split(env.get("CONFIG_PREVIOUS_MASTER_KEYS", ""), ",") {
+		if val = strings.TrimSpace(val); val == "" {
+			continue
+		}
+		if key, ok := env.key("CONFIG_PREVIOUS_MASTER_KEYS", val); ok {
+			previous = append(previous, key)
+		}
+	}
+	keyring, err := secrets.NewKeyring(primary, previous...)
+	if err != nil {
+		env.invalid("CONFIG_MASTER_KEY", err.Error())
+		return
+	}
+	cfg.Secrets.Keyring = keyring
+}
+
+// Load reads the configuration from the environment, *_FILE secrets and the
+// optional CONFIG_FILE (and .env when running locally); see loader for the
+// precedence. Every missing or invalid key is reported in the returned Errors,
+// not just the first one.
+func Load() (*Config, error) {
+	cfg, env := load()
+	if len(env.errs) > 0 {
+		return nil, env.errs
+	}
+	return cfg, nil
+}
+
+// LoadSettings loads the configuration like Load and lists every setting with
+// its source; secret values are redacted. When the configuration is invalid
+// the settings resolved so far are returned along with the errors.
+func LoadSettings() ([]Setting, error) {
+	_, env := load()
+	if len(env.errs) > 0 {
+		return env.settings, env.errs
+	}
+	return env.settings, nil
+}
+
+func load() (*Config, *loader) {
+	cfg := &Config{}
+	env := &loader{}
+	env.loadFile()
+	cfg.Environment = env.get("ENVIRONMENT", "local")
+	if cfg.IsLocal() {
+		godotenv.Load(".env")
+		cfg.loadSSHConfig(env)
+	}
+	cfg.loadServerConfig(env)
+	cfg.loadLogConfig(env)
+	cfg.loadTracingConfig(env)
+	cfg.loadDatabaseConfig(env)
+	cfg.loadGoogleConfig(env)
+	cfg.loadJWTConfig(env)
+	cfg.loadSecretsConfig(env)
+	return cfg, env
 }
 
-func mustEnv(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		log.Fatalf("missing env var: %s", key)
+// MustLoad is Load for the server entry point: it exits on invalid configuration.
+func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		logging.Fatal("invalid configuration", "error", err)
 	}
-	return val
+	return cfg
 }
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", "log:\n  level: warn\n")
+	secretFile := writeFile(t, "log_level", "error\n")
+
+	tests := []struct {
+		name       string
+		env        string
+		file       string
+		configFile string
+		want       string
+		source     string
+	}{
+		{"env wins", "debug", secretFile, configFile, "debug", "env"},
+		{"_FILE over config file", "", secretFile, configFile, "error", "LOG_LEVEL_FILE " + secretFile},
+		{"config file over default", "", "", configFile, "warn", "file " + configFile},
+		{"default", "", "", "", "info", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOG_LEVEL", tt.env)
+			t.Setenv("LOG_LEVEL_FILE", tt.file)
+			t.Setenv("CONFIG_FILE", tt.configFile)
+
+			l := &loader{}
+			l.loadFile()
+			if got := l.get("LOG_LEVEL", "info"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(l.errs) > 0 {
+				t.Errorf("errors: %v", l.errs)
+			}
+			if got := l.settings[0].Source; got != tt.source {
+				t.Errorf("source %q, want %q", got, tt.source)
+			}
+		})
+	}
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	t.Setenv("DB_PASSWORD", "hunter2")
+	l := &loader{}
+	l.get("DB_PASSWORD", "")
+	if got := l.settings[0].Value; got != redacted {
+		t.Errorf("DB_PASSWORD recorded as %q", got)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	doc := map[string]any{
+		"environment": "production",
+		"server": map[string]any{
+			"address": ":5000",
+			"timeouts": map[string]any{
+				"read": "5s",
+			},
+		},
+		"database": map[string]any{
+			"port":     5432,
+			"replicas": []any{"db-1", "db-2:6432"},
+			"sslMode":  nil,
+		},
+		"tracing": map[string]any{"sampleRatio": 0.25},
+	}
+	got := map[string]string{}
+	flatten("", doc, got)
+
+	want := map[string]string{
+		"environment":          "production",
+		"server.address":       ":5000",
+		"server.timeouts.read": "5s",
+		"database.port":        "5432",
+		"database.replicas":    "db-1,db-2:6432",
+		"tracing.sampleRatio":  "0.25",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestUnknownFileKeys(t *testing.T) {
+	for _, tt := range []struct{ name, content string }{
+		{"config.yaml", "server:\n  adress: \":5000\"\n  address: \":5000\"\nextra: 1\n"},
+		{"config.toml", "extra = 1\n[server]\nadress = \":5000\"\naddress = \":5000\"\n"},
+	} {
+		t.Setenv("CONFIG_FILE", writeFile(t, tt.name, tt.content))
+		l := &loader{}
+		l.loadFile()
+
+		var unknown []string
+		for _, e := range l.errs {
+			if e.Key != "CONFIG_FILE" {
+				t.Errorf("%s: unexpected error %v", tt.name, e)
+			}
+			unknown = append(unknown, strings.TrimPrefix(e.Message, "unknown key "))
+		}
+		if want := []string{"extra", "server.adress"}; !slices.Equal(unknown, want) {
+			t.Errorf("%s: unknown keys %v, want %v", tt.name, unknown, want)
+		}
+	}
+}
+
+func TestLoadSettingsOnError(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("DB_HOST", "")
+	t.Setenv("DB_HOST_FILE", "")
+	t.Setenv("LOG_LEVEL", "loud")
+
+	settings, err := LoadSettings()
+	if err == nil {
+		t.Fatal("invalid configuration loaded without errors")
+	}
+	errs, ok := err.(Errors)
+	if !ok || !slices.ContainsFunc(errs, func(e FieldError) bool { return e.Key == "LOG_LEVEL" }) {
+		t.Errorf("errors %v, want LOG_LEVEL among them", err)
+	}
+	i := slices.IndexFunc(settings, func(s Setting) bool { return s.Key == "ENVIRONMENT" })
+	if i < 0 || settings[i].Value != "production" || settings[i].Source != "env" {
+		t.Errorf("settings %v, want ENVIRONMENT from env", settings)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Load accepted the invalid configuration")
+	}
+}
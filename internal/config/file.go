@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileKeys maps every environment variable to its path in the config file.
+var fileKeys = map[string]string{
+	"ENVIRONMENT":                        "environment",
+	"LISTEN_ADDR":                        "server.address",
+	"METRICS_ADDR":                       "server.metricsAddress",
+	"HTTP_READ_TIMEOUT":                  "server.readTimeout",
+	"HTTP_WRITE_TIMEOUT":                 "server.writeTimeout",
+	"HTTP_IDLE_TIMEOUT":                  "server.idleTimeout",
+	"HTTP_SHUTDOWN_TIMEOUT":              "server.shutdownTimeout",
+	"HTTP_REQUEST_TIMEOUT":               "server.requestTimeout",
+	"LOG_LEVEL":                          "log.level",
+	"LOG_FORMAT":                         "log.format",
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "tracing.endpoint",
+	"OTEL_EXPORTER_OTLP_ENDPOINT":        "tracing.otlpEndpoint",
+	"OTEL_SERVICE_NAME":                  "tracing.serviceName",
+	"OTEL_TRACES_SAMPLER_ARG":            "tracing.sampleRatio",
+	"SSH_PRIVATE_KEY":                    "ssh.privateKey",
+	"SSH_PRIVATE_KEY_PASSPHRASE":         "ssh.privateKeyPassphrase",
+	"SSH_AUTH_SOCK":                      "ssh.agentSocket",
+	"SSH_HOST_KEY":                       "ssh.hostKey",
+	"SSH_KNOWN_HOSTS":                    "ssh.knownHosts",
+	"SSH_HOST":                           "ssh.host",
+	"SSH_PORT":                           "ssh.port",
+	"SSH_USER":                           "ssh.user",
+	"DB_HOST":                            "database.host",
+	"DB_PORT":                            "database.port",
+	"DB_NAME":                            "database.name",
+	"DB_USER":                            "database.user",
+	"DB_PASSWORD":                        "database.password",
+	"DB_QUERY_TIMEOUT":                   "database.queryTimeout",
+	"DB_SSLMODE":                         "database.sslMode",
+	"DB_SSLROOTCERT":                     "database.sslRootCert",
+	"DB_SSLCERT":                         "database.sslCert",
+	"DB_SSLKEY":                          "database.sslKey",
+	"DB_APPLICATION_NAME":                "database.applicationName",
+	"DB_STATEMENT_TIMEOUT":               "database.statementTimeout",
+	"DB_CONNECT_TIMEOUT":                 "database.connectTimeout",
+	"DB_POOL_MAX_CONNS":                  "database.pool.maxConns",
+	"DB_POOL_MIN_CONNS":                  "database.pool.minConns",
+	"DB_POOL_MAX_CONN_LIFETIME":          "database.pool.maxConnLifetime",
+	"DB_POOL_MAX_CONN_IDLE_TIME":         "database.pool.maxConnIdleTime",
+	"DB_REPLICA_HOSTS":                   "database.replicas",
+	"GOOGLE_API_TIMEOUT":                 "google.timeout",
+	"GOOGLE_CALENDAR_ENDPOINT":           "google.calendarEndpoint",
+	"JWT_PRIVATE_KEY":                    "jwt.privateKey",
+	"JWT_PUBLIC_KEY":                     "jwt.publicKey",
+	"CONFIG_MASTER_KEY":                  "secrets.masterKey",
+	"CONFIG_PREVIOUS_MASTER_KEYS":        "secrets.previousMasterKeys",
+}
+
+// knownFileKeys is the set of paths a config file may contain.
+var knownFileKeys = func() map[string]bool {
+	known := make(map[string]bool, len(fileKeys))
+	for _, key := range fileKeys {
+		known[key] = true
+	}
+	return known
+}()
+
+// secretKeys are never shown in the effective configuration dump.
+var secretKeys = map[string]bool{
+	"SSH_PRIVATE_KEY":             true,
+	"SSH_PRIVATE_KEY_PASSPHRASE":  true,
+	"DB_PASSWORD":                 true,
+	"JWT_PRIVATE_KEY":             true,
+	"CONFIG_MASTER_KEY":           true,
+	"CONFIG_PREVIOUS_MASTER_KEYS": true,
+}
+
+// loadFile reads the YAML or TOML file named by CONFIG_FILE, if any.
+func (l *loader) loadFile() {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.invalid("CONFIG_FILE", "can't read file: "+err.Error())
+		return
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		l.invalid("CONFIG_FILE", "must have a .yaml, .yml or .toml extension")
+		return
+	}
+	if err != nil {
+		l.invalid("CONFIG_FILE", "can't parse "+path+": "+err.Error())
+		return
+	}
+
+	l.file = map[string]string{}
+	l.fileName = "file " + path
+	flatten("", doc, l.file)
+
+	for _, key := range slices.Sorted(maps.Keys(l.file)) {
+		if !knownFileKeys[key] {
+			l.invalid("CONFIG_FILE", "unknown key "+key)
+		}
+	}
+}
+
+// flatten turns nested tables into dotted keys. Lists become comma-separated
+// values, the form environment variables use.
+func flatten(prefix string, doc map[string]any, res map[string]string) {
+	for key, val := range doc {
+		switch v := val.(type) {
+		case map[string]any:
+			flatten(prefix+key+".", v, res)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			res[prefix+key] = strings.Join(items, ",")
+		case nil:
+		default:
+			res[prefix+key] = fmt.Sprint(v)
+		}
+	}
+}
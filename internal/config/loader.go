@@ -0,0 +1,178 @@
+package config
+
+import (
+	"core-regulus-backend/internal/secrets"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is a single missing or invalid configuration key.
+type FieldError struct {
+	Key     string
+	Message string
+}
+
+// Errors lists every problem found while loading or validating configuration.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, fe := range e {
+		lines = append(lines, fe.Key+": "+fe.Message)
+	}
+	return strings.Join(lines, "; ")
+}
+
+// Setting is one entry of the effective configuration: where its value came
+// from and, unless it is a secret, the value itself.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+const redacted = "[REDACTED]"
+
+// loader resolves configuration keys and collects errors instead of stopping
+// at the first one. A key is taken from, in order of precedence:
+//
+//  1. the environment variable KEY,
+//  2. the file named by KEY_FILE (Docker and Kubernetes secrets),
+//  3. the config file named by CONFIG_FILE,
+//  4. the built-in default.
+type loader struct {
+	errs     Errors
+	file     map[string]string
+	fileName string
+	settings []Setting
+}
+
+func (l *loader) invalid(key, message string) {
+	l.errs = append(l.errs, FieldError{Key: key, Message: message})
+}
+
+func (l *loader) lookup(key string) (string, string) {
+	if val := os.Getenv(key); val != "" {
+		return val, "env"
+	}
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.invalid(key+"_FILE", "can't read file: "+err.Error())
+			return "", ""
+		}
+		return strings.TrimRight(string(data), "\r\n"), key + "_FILE " + path
+	}
+	if val, ok := l.file[fileKeys[key]]; ok && val != "" {
+		return val, l.fileName
+	}
+	return "", ""
+}
+
+func (l *loader) record(key, val, source string) {
+	switch {
+	case secretKeys[key] && val != "":
+		val = redacted
+	case strings.Contains(val, "\n"):
+		val = fmt.Sprintf("<%d bytes>", len(val))
+	}
+	l.settings = append(l.settings, Setting{Key: key, Value: val, Source: source})
+}
+
+func (l *loader) get(key, def string) string {
+	val, source := l.lookup(key)
+	if source == "" {
+		val, source = def, "default"
+	}
+	l.record(key, val, source)
+	return val
+}
+
+func (l *loader) require(key string) string {
+	val, source := l.lookup(key)
+	if source == "" {
+		l.invalid(key, "is required")
+		source = "missing"
+	}
+	l.record(key, val, source)
+	return val
+}
+
+func (l *loader) port(key string) int {
+	val := l.require(key)
+	if val == "" {
+		return 0
+	}
+	port, err := strconv.Atoi(val)
+	if err != nil || port < 1 || port > 65535 {
+		l.invalid(key, "must be a port number between 1 and 65535")
+	}
+	return port
+}
+
+func (l *loader) int(key string, def, minimum int) int {
+	val := l.get(key, strconv.Itoa(def))
+	n, err := strconv.Atoi(val)
+	if err != nil || n < minimum {
+		l.invalid(key, fmt.Sprintf("must be an integer of at least %d", minimum))
+		return def
+	}
+	return n
+}
+
+// hostPorts parses a comma-separated list of host or host:port entries.
+func (l *loader) hostPorts(key string, defaultPort int) []HostPort {
+	var res []HostPort
+	for _, entry := range strings.Split(l.get(key, ""), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(entry)
+		if err != nil {
+			res = append(res, HostPort{Host: entry, Port: defaultPort})
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 || host == "" {
+			l.invalid(key, "must be a comma-separated list of host or host:port entries")
+			continue
+		}
+		res = append(res, HostPort{Host: host, Port: port})
+	}
+	return res
+}
+
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	val := l.get(key, def.String())
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		l.invalid(key, "must be a positive duration such as 10s or 1m")
+		return def
+	}
+	return d
+}
+
+func (l *loader) oneOf(key, def string, allowed ...string) string {
+	val := l.get(key, def)
+	if !slices.Contains(allowed, val) {
+		l.invalid(key, "must be one of "+strings.Join(allowed, ", "))
+	}
+	return val
+}
+
+// key decodes a base64 master key; key names the variable it came from.
+func (l *loader) key(key, val string) ([]byte, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(val)
+	if err != nil || len(decoded) != secrets.KeySize {
+		l.invalid(key, fmt.Sprintf("must be a base64-encoded %d-byte key", secrets.KeySize))
+		return nil, false
+	}
+	return decoded, true
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"bytes"
+	"core-regulus-backend/internal/validation"
+	"encoding/json"
+	"fmt"
+)
+
+// ServiceAccount is a Google service account key. JSON keeps the original
+// document, which is what the Google client libraries parse.
+type ServiceAccount struct {
+	Type        string `json:"type" validate:"eq=service_account"`
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email" validate:"required,email"`
+	PrivateKey  string `json:"private_key" validate:"required"`
+	JSON        []byte `json:"-"`
+}
+
+// UnmarshalJSON accepts the key either as an object or as a string holding it.
+func (s *ServiceAccount) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		data = []byte(str)
+	}
+	type plain ServiceAccount
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	s.JSON = bytes.Clone(data)
+	return nil
+}
+
+// Runtime is the typed view of config.config, the settings stored in the
+// database rather than the environment.
+type Runtime struct {
+	GoogleCalendarID string         `json:"googleCalendarId" validate:"required,email"`
+	GoogleCalendar   ServiceAccount `json:"googleCalendar" validate:"-"`
+}
+
+// RuntimeKeys are the config.config entries Runtime is decoded from.
+var RuntimeKeys = []string{"googleCalendarId", "googleCalendar"}
+
+var tagMessages = map[string]string{
+	"required": "is required",
+	"email":    "must be an email address",
+	"eq":       "has an unexpected value",
+}
+
+// ParseRuntime decodes and validates the contents of config.config.
+func ParseRuntime(raw map[string]any) (*Runtime, error) {
+	var errs Errors
+	for _, key := range RuntimeKeys {
+		if _, ok := raw[key]; !ok {
+			errs = append(errs, FieldError{Key: key, Message: "is missing from config.config"})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var rt Runtime
+	for _, key := range RuntimeKeys {
+		data, err := json.Marshal(raw[key])
+		if err == nil {
+			err = json.Unmarshal([]byte(fmt.Sprintf(`{%q:%s}`, key, data)), &rt)
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Key: key, Message: "can't decode: " + err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	errs = append(errs, fieldErrors("", validation.Struct(rt))...)
+	errs = append(errs, fieldErrors("googleCalendar.", validation.Struct(rt.GoogleCalendar))...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &rt, nil
+}
+
+func fieldErrors(prefix string, errs []validation.ErrorResponse) Errors {
+	var res Errors
+	for _, e := range errs {
+		message, ok := tagMessages[e.Tag]
+		if !ok {
+			message = "failed " + e.Tag + " check"
+		}
+		res = append(res, FieldError{Key: prefix + e.FailedField, Message: message})
+	}
+	return res
+}
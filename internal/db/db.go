@@ -1,136 +1,218 @@
 package db
 
-import (	
+import (
 	"context"
 	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/metrics"
+	"core-regulus-backend/internal/secrets"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net"
+	"log/slog"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/ssh"
 )
 
 type ConfigMap map[string]interface{}
 
-var once sync.Once
-var poolOnce sync.Once
-var configOnce sync.Once
-var mainPool *pgxpool.Pool
-var dbConfig ConfigMap
-
-func checkSSH() {
-	once.Do(func() {
-		cfg := config.Get()	
-		if (cfg.IsLocal()) {
-			connectSSH(cfg)	
-		}		
-	})	
+// DB owns the connection pool, the SSH tunnel used in local environment and
+// the cached contents of config.config.
+type DB struct {
+	Pool *pgxpool.Pool
+
+	cfg           config.DatabaseConfig
+	keyring       *secrets.Keyring
+	poolMetrics   *poolCollector
+	configMu      sync.Mutex
+	dbConfig      atomic.Pointer[ConfigMap]
+	subscribersMu sync.Mutex
+	subscribers   []func(ConfigChange)
+	watchCancel   context.CancelFunc
+	watchDone     chan struct{}
+	tunnel        *Tunnel
+	router        *router
 }
 
-
-
-func connectSSH(cfg *config.Config) {
-	signer, err := ssh.ParsePrivateKey([]byte(cfg.SSH.PrivateKey))
+// Open establishes the SSH tunnel when running locally and creates the
+// connection pool.
+func Open(ctx context.Context, cfg *config.Config) (*DB, error) {
+	d := &DB{cfg: cfg.Database, keyring: cfg.Secrets.Keyring}
+	host, port := cfg.Database.Host, cfg.Database.Port
+	if cfg.IsLocal() {
+		tunnel, err := NewTunnel(cfg.SSH, remoteAddr(cfg.Database))
+		if err != nil {
+			return nil, err
+		}
+		d.tunnel = tunnel
+		host, port = tunnel.Addr()
+	}
+	pool, err := connectDB(ctx, cfg.Database, host, port)
 	if err != nil {
-		log.Fatalf("parse private key: %v", err)
+		d.Close()
+		return nil, err
+	}
+	d.Pool = pool
+	replicas := cfg.Database
+	if cfg.IsLocal() && len(replicas.Replicas) > 0 {
+		// Replicas are dialled directly, which doesn't work from behind the tunnel.
+		slog.Warn("database replicas are ignored in local environment")
+		replicas.Replicas = nil
 	}
+	d.router, err = openReplicas(replicas, pool)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.poolMetrics = newPoolCollector(pool)
+	if err := metrics.Register(d.poolMetrics); err != nil {
+		// Only one pool can be registered; a second one, e.g. from a tool
+		// opening another connection, goes without metrics.
+		slog.Warn("database pool metrics are not exported", "error", err)
+		d.poolMetrics = nil
+	}
+	return d, nil
+}
+
+// New wraps a pool created elsewhere, without tunnel, replicas or metrics.
+// It is meant for tests and tools.
+func New(pool *pgxpool.Pool, cfg config.DatabaseConfig) *DB {
+	return &DB{Pool: pool, cfg: cfg}
+}
+
+// WithQueryTimeout bounds ctx by the configured per-query timeout.
+func (d *DB) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.cfg.QueryTimeout)
+}
 
-	sshConfig := &ssh.ClientConfig{
-		User:            cfg.SSH.User,
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
+func (d *DB) Ping(ctx context.Context) error {
+	return d.Pool.Ping(ctx)
+}
+
+// CheckTunnel reports whether the SSH tunnel used in local environment is alive.
+func (d *DB) CheckTunnel(ctx context.Context) error {
+	if d.tunnel == nil {
+		return errTunnelDown
 	}
+	return d.tunnel.Check(ctx)
+}
 
-	sshAddr := fmt.Sprintf("%s:%d", cfg.SSH.Host, cfg.SSH.Port)
-	sshClient, err := ssh.Dial("tcp", sshAddr, sshConfig)
-	if err != nil {
-		log.Fatalf("SSH dial error: %v", err)
+// CheckSettings reports whether config.config is loaded and passes validation.
+func (d *DB) CheckSettings(ctx context.Context) error {
+	_, err := d.Settings(ctx)
+	return err
+}
+
+// Close releases the connection pool and, when running locally, the SSH
+// tunnel, waiting for forwarded connections to finish.
+func (d *DB) Close() {
+	if d.watchCancel != nil {
+		d.watchCancel()
+		<-d.watchDone
+	}
+	if d.poolMetrics != nil {
+		metrics.Unregister(d.poolMetrics)
+	}
+	if d.router != nil {
+		d.router.close()
 	}
+	if d.Pool != nil {
+		d.Pool.Close()
+	}
+	if d.tunnel != nil {
+		d.tunnel.Close()
+	}
+}
 
-	remoteAddr := fmt.Sprintf("%s:%d", cfg.Database.Host, cfg.Database.Port)
-	localListener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Database.Host, cfg.Database.Port))
+// LoadConfig reads the raw rows of config.config.
+func LoadConfig(ctx context.Context, q Querier) (ConfigMap, error) {
+	rows, err := q.Query(ctx, "select code, value from config.config")
 	if err != nil {
-		log.Fatalf("local port listen error: %v", err)
-	}
-
-	go func() {
-		for {
-			localConn, err := localListener.Accept()
-			if err != nil {
-				continue
-			}
-			go func() {
-				defer localConn.Close()
-				remoteConn, err := sshClient.Dial("tcp", remoteAddr)
-				if err != nil {
-					return
-				}
-				defer remoteConn.Close()
-
-				go io.Copy(remoteConn, localConn)
-				io.Copy(localConn, remoteConn)
-			}()
+		return nil, fmt.Errorf("query config: %w", err)
+	}
+	defer rows.Close()
+	res := ConfigMap{}
+	for rows.Next() {
+		var code string
+		var value any
+		if err := rows.Scan(&code, &value); err != nil {
+			return nil, fmt.Errorf("decode config: %w", err)
 		}
-	}()
+		res[code] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query config: %w", err)
+	}
+	return res, nil
 }
 
-func connectDB(cfg *config.Config) (*pgxpool.Pool, error) {
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-					cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
-	
-	dbpool, err := pgxpool.New(context.Background(), dsn)
+// loadConfig reads config.config from q and decrypts encrypted values.
+func (d *DB) loadConfig(ctx context.Context, q Querier) (ConfigMap, error) {
+	raw, err := LoadConfig(ctx, q)
 	if err != nil {
-		log.Fatalf("Unable to create connection pool: %v", err)
+		return nil, err
 	}
-	return dbpool, err
+	return DecryptConfig(raw, d.keyring)
 }
 
-func Connect() *pgxpool.Pool {
-	poolOnce.Do(func() {
-		cfg := config.Get()			
-		var err error
-		checkSSH()
-		mainPool, err = connectDB(cfg)		
+// DecryptConfig returns a copy of raw with every encrypted value replaced by
+// its plaintext.
+func DecryptConfig(raw ConfigMap, keyring *secrets.Keyring) (ConfigMap, error) {
+	res := make(ConfigMap, len(raw))
+	for code, val := range raw {
+		envelope, ok := secrets.Parse(val)
+		if !ok {
+			res[code] = val
+			continue
+		}
+		plaintext, err := keyring.Decrypt(code, envelope)
 		if err != nil {
-			log.Fatal("Error:", err)
-		}		
-	})
-	return mainPool
+			return nil, fmt.Errorf("config %s: %w", code, err)
+		}
+		var decoded any
+		if err := json.Unmarshal(plaintext, &decoded); err != nil {
+			return nil, fmt.Errorf("config %s: decode decrypted value: %w", code, err)
+		}
+		res[code] = decoded
+	}
+	return res, nil
 }
 
-func Config() *ConfigMap {
-	configOnce.Do(func() {
-		pool := Connect()
-		ctx := context.Background()
-		var jsonData []byte
-		err := pool.QueryRow(ctx, "select config.get()").Scan(&jsonData)
-		if err != nil {
-			log.Fatal("Query config error", err)
-		}		
-		if err := json.Unmarshal(jsonData, &dbConfig); err != nil {
-			log.Fatal(err)
-		}				
-	})	
-	return &dbConfig
+// SetConfigValue stores value under code in config.config.
+func (d *DB) SetConfigValue(ctx context.Context, code string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = d.Pool.Exec(ctx, "select config.set($1, $2)", code, data)
+	return err
 }
 
-func (c ConfigMap) GetString(key string) (string, bool) {
-	if val, ok := c[key]; ok {
-		switch v := val.(type) {
-		case string:
-			return v, true
-		default:
-			jsonBytes, err := json.Marshal(v)
-			if err == nil {
-				return string(jsonBytes), true
-			}
-		}
+// Config returns the current config.config, loading it on first use. A failed
+// load is not cached, so the next call retries. The returned map is replaced,
+// never modified, when the watcher reloads the configuration.
+func (d *DB) Config(ctx context.Context) (ConfigMap, error) {
+	if cfg := d.dbConfig.Load(); cfg != nil {
+		return *cfg, nil
+	}
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	if cfg := d.dbConfig.Load(); cfg != nil {
+		return *cfg, nil
+	}
+	res, err := d.loadConfig(ctx, d.Reader())
+	if err != nil {
+		return nil, err
 	}
-	return "", false
-}
\ No newline at end of file
+	d.dbConfig.Store(&res)
+	return res, nil
+}
+
+// Settings returns the typed, validated view of config.config.
+func (d *DB) Settings(ctx context.Context) (*config.Runtime, error) {
+	cfg, err := d.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseRuntime(cfg)
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/tracing"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	connectAttemptTimeout = 5 * time.Second
+	connectMinBackoff     = 500 * time.Millisecond
+	connectMaxBackoff     = 5 * time.Second
+)
+
+// dsn builds a keyword/value connection string. host and port are passed
+// separately because they point at the tunnel when running locally.
+func dsn(cfg config.DatabaseConfig, host string, port int) string {
+	params := [][2]string{
+		{"host", host},
+		{"port", strconv.Itoa(port)},
+		{"user", cfg.User},
+		{"password", cfg.Password},
+		{"dbname", cfg.Name},
+		{"sslmode", cfg.SSLMode},
+		{"connect_timeout", strconv.Itoa(int(connectAttemptTimeout.Seconds()))},
+	}
+	for _, p := range [][2]string{
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+	} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, p[0]+"="+quoteDSNValue(p[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue quotes v so that spaces, quotes and backslashes in passwords
+// survive parsing.
+func quoteDSNValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// poolConfig connects to host:port and verifies the server certificate
+// against tlsHost.
+func poolConfig(cfg config.DatabaseConfig, host string, port int, tlsHost string) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn(cfg, host, port))
+	if err != nil {
+		return nil, fmt.Errorf("parse connection config: %w", err)
+	}
+	connConfig := poolConfig.ConnConfig
+	connConfig.Tracer = tracing.QueryTracer{}
+	connConfig.RuntimeParams["application_name"] = cfg.ApplicationName
+	if cfg.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	// Through the tunnel the connection goes to 127.0.0.1, but the
+	// certificate is issued for the database host.
+	if host != tlsHost {
+		if connConfig.TLSConfig != nil {
+			connConfig.TLSConfig.ServerName = tlsHost
+		}
+		for _, fallback := range connConfig.Fallbacks {
+			if fallback.TLSConfig != nil {
+				fallback.TLSConfig.ServerName = tlsHost
+			}
+		}
+	}
+
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	return poolConfig, nil
+}
+
+// connectDB creates the pool and waits, retrying with backoff, until Postgres
+// accepts connections or cfg.ConnectTimeout elapses.
+func connectDB(ctx context.Context, cfg config.DatabaseConfig, host string, port int) (*pgxpool.Pool, error) {
+	poolConfig, err := poolConfig(cfg, host, port, cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	dbpool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create connection pool: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	backoff := connectMinBackoff
+	for attempt := 1; ; attempt++ {
+		err = dbpool.Ping(ctx)
+		if err == nil {
+			return dbpool, nil
+		}
+		slog.Warn("database is not reachable yet, retrying", "attempt", attempt, "error", err, "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			dbpool.Close()
+			return nil, fmt.Errorf("connect to database after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, connectMaxBackoff)
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"core-regulus-backend/internal/config"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestQuoteDSNValue(t *testing.T) {
+	tests := []struct{ value, quoted string }{
+		{"secret", `'secret'`},
+		{"", `''`},
+		{"with space", `'with space'`},
+		{"it's", `'it\'s'`},
+		{`back\slash`, `'back\\slash'`},
+		{`a' b\'c=`, `'a\' b\\\'c='`},
+	}
+	for _, tt := range tests {
+		if got := quoteDSNValue(tt.value); got != tt.quoted {
+			t.Errorf("quoteDSNValue(%q) = %s, want %s", tt.value, got, tt.quoted)
+		}
+		cfg := config.DatabaseConfig{User: "app", Password: tt.value, Name: "app db", SSLMode: "disable"}
+		parsed, err := pgconn.ParseConfig(dsn(cfg, "db.example.com", 5432))
+		if err != nil {
+			t.Errorf("password %q: %v", tt.value, err)
+			continue
+		}
+		if parsed.Password != tt.value || parsed.Database != "app db" {
+			t.Errorf("password %q: parsed password %q, database %q", tt.value, parsed.Password, parsed.Database)
+		}
+	}
+}
+
+func TestPoolConfig(t *testing.T) {
+	base := config.DatabaseConfig{
+		Host:            "db.example.com",
+		User:            "app",
+		Name:            "app",
+		ApplicationName: "core-regulus-backend",
+		MaxConns:        8,
+	}
+	tests := []struct {
+		name             string
+		sslMode          string
+		host             string
+		statementTimeout time.Duration
+		serverName       string
+		timeout          string
+	}{
+		{"direct", "verify-full", "db.example.com", 30 * time.Second, "db.example.com", "30000"},
+		{"tunnel", "verify-full", "127.0.0.1", 30 * time.Second, "db.example.com", "30000"},
+		{"tunnel with fallback", "prefer", "127.0.0.1", 1500 * time.Millisecond, "db.example.com", "1500"},
+		{"no tls", "disable", "127.0.0.1", 0, "", ""},
+	}
+	for _, tt := range tests {
+		cfg := base
+		cfg.SSLMode = tt.sslMode
+		cfg.StatementTimeout = tt.statementTimeout
+		pc, err := poolConfig(cfg, tt.host, 6543, cfg.Host)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		conn := pc.ConnConfig
+		if conn.Host != tt.host || conn.Port != 6543 {
+			t.Errorf("%s: connects to %s:%d", tt.name, conn.Host, conn.Port)
+		}
+
+		var serverNames []string
+		if conn.TLSConfig != nil {
+			serverNames = append(serverNames, conn.TLSConfig.ServerName)
+		}
+		for _, fallback := range conn.Fallbacks {
+			if fallback.TLSConfig != nil {
+				serverNames = append(serverNames, fallback.TLSConfig.ServerName)
+			}
+		}
+		if tt.serverName == "" && len(serverNames) > 0 {
+			t.Errorf("%s: TLS configured with sslmode=%s", tt.name, tt.sslMode)
+		}
+		if tt.serverName != "" && len(serverNames) == 0 {
+			t.Errorf("%s: no TLS config", tt.name)
+		}
+		for _, name := range serverNames {
+			if name != tt.serverName {
+				t.Errorf("%s: TLS server name %q, want %q", tt.name, name, tt.serverName)
+			}
+		}
+
+		timeout, ok := conn.RuntimeParams["statement_timeout"]
+		if timeout != tt.timeout || ok != (tt.timeout != "") {
+			t.Errorf("%s: statement_timeout = %q, want %q", tt.name, timeout, tt.timeout)
+		}
+		if got := conn.RuntimeParams["application_name"]; got != "core-regulus-backend" {
+			t.Errorf("%s: application_name = %q", tt.name, got)
+		}
+		if pc.MaxConns != 8 {
+			t.Errorf("%s: MaxConns = %d", tt.name, pc.MaxConns)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	replicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout  = 2 * time.Second
+)
+
+// Querier is implemented by *pgxpool.Pool and by the pool returned from
+// DB.Reader.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type replica struct {
+	addr    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+func (r *replica) setHealthy(healthy bool, err error) {
+	if r.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		slog.Info("database replica is back", "replica", r.addr)
+	} else {
+		slog.Warn("database replica is unavailable, reading from primary", "replica", r.addr, "error", err)
+	}
+}
+
+// router sends read-only calls to healthy replicas in turn and falls back to
+// the primary when none is available or a replica fails mid-call.
+type router struct {
+	primary  *pgxpool.Pool
+	replicas []*replica
+	next     atomic.Uint32
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// openReplicas creates replica pools; they connect lazily, so a replica that
+// is down at startup is simply marked unhealthy by the first check.
+func openReplicas(cfg config.DatabaseConfig, primary *pgxpool.Pool) (*router, error) {
+	r := &router{primary: primary, done: make(chan struct{})}
+	for _, hp := range cfg.Replicas {
+		poolConfig, err := poolConfig(cfg, hp.Host, hp.Port, hp.Host)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		rep := &replica{addr: net.JoinHostPort(hp.Host, strconv.Itoa(hp.Port)), pool: pool}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+	if len(r.replicas) > 0 {
+		r.wg.Add(1)
+		go r.checkLoop()
+	}
+	return r, nil
+}
+
+func (r *router) checkLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		r.check()
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *router) check() {
+	for _, rep := range r.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+		err := rep.pool.Ping(ctx)
+		cancel()
+		rep.setHealthy(err == nil, err)
+	}
+}
+
+func (r *router) pick() *replica {
+	n := len(r.replicas)
+	start := int(r.next.Add(1))
+	for i := range n {
+		rep := r.replicas[(start+i)%n]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+func (r *router) close() {
+	close(r.done)
+	r.wg.Wait()
+	for _, rep := range r.replicas {
+		rep.pool.Close()
+	}
+}
+
+// Reader returns a Querier for read-only calls. Writes must go to Pool.
+func (d *DB) Reader() Querier {
+	if d.router == nil || len(d.router.replicas) == 0 {
+		return d.Pool
+	}
+	return readQuerier{r: d.router}
+}
+
+type readQuerier struct {
+	r *router
+}
+
+func (q readQuerier) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	rep := q.r.pick()
+	if rep == nil {
+		return q.r.primary.Exec(ctx, sql, args...)
+	}
+	tag, err := rep.pool.Exec(ctx, sql, args...)
+	if shouldFallback(ctx, err) {
+		rep.setHealthy(false, err)
+		return q.r.primary.Exec(ctx, sql, args...)
+	}
+	return tag, err
+}
+
+// Query falls back to the primary when the replica fails before the first row.
+// Failures only show up once rows are read, so the first row is fetched here;
+// an error after it has been returned can't be retried and is reported as is.
+func (q readQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rep := q.r.pick()
+	if rep == nil {
+		return q.r.primary.Query(ctx, sql, args...)
+	}
+	rows, err := rep.pool.Query(ctx, sql, args...)
+	if err == nil {
+		if rows.Next() {
+			return &peekedRows{Rows: rows, first: true}, nil
+		}
+		rows.Close()
+		err = rows.Err()
+		if err == nil {
+			return rows, nil
+		}
+	}
+	if shouldFallback(ctx, err) {
+		rep.setHealthy(false, err)
+		return q.r.primary.Query(ctx, sql, args...)
+	}
+	return nil, err
+}
+
+// peekedRows returns the row Query already advanced to before the rest.
+type peekedRows struct {
+	pgx.Rows
+	first bool
+}
+
+func (r *peekedRows) Next() bool {
+	if r.first {
+		r.first = false
+		return true
+	}
+	return r.Rows.Next()
+}
+
+func (q readQuerier) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rep := q.r.pick()
+	if rep == nil {
+		return q.r.primary.QueryRow(ctx, sql, args...)
+	}
+	return fallbackRow{
+		row: rep.pool.QueryRow(ctx, sql, args...),
+		fallback: func(err error) pgx.Row {
+			rep.setHealthy(false, err)
+			return q.r.primary.QueryRow(ctx, sql, args...)
+		},
+		ctx: ctx,
+	}
+}
+
+// fallbackRow retries on the primary when the replica fails before
+// returning a row. pgx only reports errors from Scan.
+type fallbackRow struct {
+	row      pgx.Row
+	fallback func(error) pgx.Row
+	ctx      context.Context
+}
+
+func (r fallbackRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if shouldFallback(r.ctx, err) {
+		return r.fallback(err).Scan(dest...)
+	}
+	return err
+}
+
+// shouldFallback reports whether err means the replica, rather than the query,
+// failed: connection errors and conflicts with recovery. Anything else, such
+// as a scan or type error, would fail on the primary as well.
+func shouldFallback(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure is what a replica reports when a query is
+		// cancelled by replay.
+		return pgErr.Code == "40001"
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
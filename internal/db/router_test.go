@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryable is how pgconn marks errors that happened before the query was sent.
+type retryable struct{ error }
+
+func (retryable) SafeToRetry() bool { return true }
+
+func TestShouldFallback(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"no error", context.Background(), nil, false},
+		{"no rows", context.Background(), pgx.ErrNoRows, false},
+		{"recovery conflict", context.Background(), &pgconn.PgError{Code: "40001"}, true},
+		{"wrapped recovery conflict", context.Background(), fmt.Errorf("query: %w", &pgconn.PgError{Code: "40001"}), true},
+		{"query error", context.Background(), &pgconn.PgError{Code: "22P02"}, false},
+		{"undefined table", context.Background(), &pgconn.PgError{Code: "42P01"}, false},
+		{"scan error", context.Background(), errors.New("can't scan into dest[0]: cannot scan text into *int"), false},
+		{"network error", context.Background(), refused, true},
+		{"wrapped network error", context.Background(), fmt.Errorf("acquire: %w", refused), true},
+		{"connection closed", context.Background(), io.ErrUnexpectedEOF, true},
+		{"safe to retry", context.Background(), retryable{errors.New("conn busy")}, true},
+		{"cancelled request", cancelled, refused, false},
+	}
+	for _, tt := range tests {
+		if got := shouldFallback(tt.ctx, tt.err); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
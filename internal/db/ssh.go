@@ -0,0 +1,153 @@
+package db
+
+import (
+	"bytes"
+	"core-regulus-backend/internal/config"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshDialTimeout = 5 * time.Second
+
+// dialSSH connects to the bastion, authenticating with the configured key
+// and/or the SSH agent and verifying the host key. There is no insecure
+// fallback: a host key that doesn't match fails the connection.
+func dialSSH(cfg config.SSHConfig) (*ssh.Client, error) {
+	sshAddr := net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port))
+	hostKeyCallback, hostKeyAlgorithms, err := hostKeyCallback(cfg, sshAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		signer, err := parsePrivateKey(cfg)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.AgentSocket != "" {
+		conn, err := net.Dial("unix", cfg.AgentSocket)
+		if err != nil {
+			return nil, fmt.Errorf("connect to SSH agent: %w", err)
+		}
+		// The agent is only needed during the handshake.
+		defer conn.Close()
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:              cfg.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           sshDialTimeout,
+	}
+	client, err := ssh.Dial("tcp", sshAddr, sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("SSH dial %s: %w", sshAddr, err)
+	}
+	return client, nil
+}
+
+func parsePrivateKey(cfg config.SSHConfig) (ssh.Signer, error) {
+	if cfg.PrivateKeyPassphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase([]byte(cfg.PrivateKey), []byte(cfg.PrivateKeyPassphrase))
+		if err != nil {
+			return nil, fmt.Errorf("parse SSH private key: %w", err)
+		}
+		return signer, nil
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, errors.New("SSH private key is encrypted, set SSH_PRIVATE_KEY_PASSPHRASE or use the SSH agent")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse SSH private key: %w", err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback accepts only the pinned SSH_HOST_KEY when set, otherwise
+// the keys listed in the known_hosts file. It also returns the host key
+// algorithms to negotiate so a server offering several keys presents one we
+// can verify; nil leaves the default order, e.g. for a bare fingerprint.
+func hostKeyCallback(cfg config.SSHConfig, addr string) (ssh.HostKeyCallback, []string, error) {
+	if cfg.HostKey == "" {
+		callback, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load known_hosts: %w", err)
+		}
+		return callback, knownHostKeyAlgorithms(callback, addr), nil
+	}
+
+	if strings.HasPrefix(cfg.HostKey, "SHA256:") {
+		return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != cfg.HostKey {
+				return fmt.Errorf("SSH host key mismatch for %s: got %s, want %s", hostname, fingerprint, cfg.HostKey)
+			}
+			return nil
+		}, nil, nil
+	}
+
+	pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse SSH_HOST_KEY: %w", err)
+	}
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		if !bytes.Equal(key.Marshal(), pinned.Marshal()) {
+			return fmt.Errorf("SSH host key mismatch for %s: got %s, want %s",
+				hostname, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(pinned))
+		}
+		return nil
+	}, keyAlgorithms(pinned.Type()), nil
+}
+
+// probeKey matches no known_hosts entry, so checking it lists the entries for
+// a host in the returned KeyError.
+type probeKey struct{}
+
+func (probeKey) Type() string                        { return "probe" }
+func (probeKey) Marshal() []byte                     { return []byte("probe") }
+func (probeKey) Verify([]byte, *ssh.Signature) error { return errors.New("probe key") }
+
+// knownHostKeyAlgorithms returns the algorithms of the known_hosts entries
+// for addr, in file order, or nil when the host isn't listed.
+func knownHostKeyAlgorithms(callback ssh.HostKeyCallback, addr string) []string {
+	var keyErr *knownhosts.KeyError
+	if err := callback(addr, &net.TCPAddr{}, probeKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		for _, algorithm := range keyAlgorithms(known.Key.Type()) {
+			if !slices.Contains(algorithms, algorithm) {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// keyAlgorithms lists the signature algorithms usable with a key type; RSA
+// keys sign with SHA-2 unless the server only supports ssh-rsa.
+func keyAlgorithms(keyType string) []string {
+	switch keyType {
+	case ssh.KeyAlgoRSA:
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	case ssh.CertAlgoRSAv01:
+		return []string{ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01}
+	default:
+		return []string{keyType}
+	}
+}
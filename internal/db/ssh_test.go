@@ -0,0 +1,185 @@
+package db
+
+import (
+	"core-regulus-backend/internal/config"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const bastion = "bastion.example:2222"
+
+func ed25519Signer(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func ecdsaSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func knownHostsFile(t *testing.T, keys ...ssh.PublicKey) string {
+	t.Helper()
+	var content []byte
+	for _, key := range keys {
+		content = append(content, knownhosts.Line([]string{bastion}, key)+"\n"...)
+	}
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPinnedHostKey(t *testing.T) {
+	host := ed25519Signer(t).PublicKey()
+	other := ed25519Signer(t).PublicKey()
+
+	tests := []struct {
+		name       string
+		hostKey    string
+		algorithms []string
+	}{
+		{"fingerprint", ssh.FingerprintSHA256(host), nil},
+		{"authorized key", string(ssh.MarshalAuthorizedKey(host)), []string{ssh.KeyAlgoED25519}},
+	}
+	for _, tt := range tests {
+		callback, algorithms, err := hostKeyCallback(config.SSHConfig{HostKey: tt.hostKey}, bastion)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(algorithms, tt.algorithms) {
+			t.Errorf("%s: algorithms = %v, want %v", tt.name, algorithms, tt.algorithms)
+		}
+		if err := callback(bastion, &net.TCPAddr{}, host); err != nil {
+			t.Errorf("%s: pinned key rejected: %v", tt.name, err)
+		}
+		if err := callback(bastion, &net.TCPAddr{}, other); err == nil {
+			t.Errorf("%s: another key was accepted", tt.name)
+		}
+	}
+}
+
+func TestPinnedHostKeyMustParse(t *testing.T) {
+	for _, hostKey := range []string{"ssh-ed25519 not-base64", "bastion.example"} {
+		if _, _, err := hostKeyCallback(config.SSHConfig{HostKey: hostKey}, bastion); err == nil {
+			t.Errorf("SSH_HOST_KEY %q was accepted", hostKey)
+		}
+	}
+}
+
+func TestKnownHostKeyAlgorithms(t *testing.T) {
+	rsaKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC9QRzbG8WyQDoUJKFfN09AVzOpdPxO/sVzuzSBSVrHBLGHbk03r/2mu2lgA79zlbXeh4bqzdmORAkMzs4K63nImpN/KJ/MMZOU6PF1nLr+rb3nfTtWu3ja8dWb1iLb9W5ezUlzNNP2OSXpv+TCQvqC71bzvbjm4/C2S3/XJcdLEQ=="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := knownHostsFile(t, ed25519Signer(t).PublicKey(), rsaKey)
+
+	_, algorithms, err := hostKeyCallback(config.SSHConfig{KnownHostsFile: path}, bastion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	if !slices.Equal(algorithms, want) {
+		t.Errorf("algorithms = %v, want %v", algorithms, want)
+	}
+
+	_, algorithms, err = hostKeyCallback(config.SSHConfig{KnownHostsFile: path}, "elsewhere.example:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algorithms != nil {
+		t.Errorf("algorithms for an unknown host = %v, want the defaults", algorithms)
+	}
+}
+
+// handshake connects to a local server offering hostKeys and reports
+// whether the client accepted it.
+func handshake(t *testing.T, cfg config.SSHConfig, hostKeys ...ssh.Signer) error {
+	t.Helper()
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	for _, key := range hostKeys {
+		serverConfig.AddHostKey(key)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		ssh.NewServerConn(serverConn, serverConfig)
+	}()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	callback, algorithms, err := hostKeyCallback(cfg, bastion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, _, err := ssh.NewClientConn(clientConn, bastion, &ssh.ClientConfig{
+		User:              "tunnel",
+		HostKeyCallback:   callback,
+		HostKeyAlgorithms: algorithms,
+	})
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+func TestHandshakeNegotiatesKnownKeyType(t *testing.T) {
+	ecdsaKey, ed25519Key := ecdsaSigner(t), ed25519Signer(t)
+
+	// The server prefers ECDSA; only its Ed25519 key is on record.
+	known := config.SSHConfig{KnownHostsFile: knownHostsFile(t, ed25519Key.PublicKey())}
+	if err := handshake(t, known, ecdsaKey, ed25519Key); err != nil {
+		t.Errorf("known_hosts: %v", err)
+	}
+	pinned := config.SSHConfig{HostKey: string(ssh.MarshalAuthorizedKey(ed25519Key.PublicKey()))}
+	if err := handshake(t, pinned, ecdsaKey, ed25519Key); err != nil {
+		t.Errorf("pinned key: %v", err)
+	}
+
+	stranger := config.SSHConfig{KnownHostsFile: knownHostsFile(t, ed25519Signer(t).PublicKey())}
+	if err := handshake(t, stranger, ecdsaKey, ed25519Key); err == nil {
+		t.Error("handshake with an unknown host key succeeded")
+	}
+	fingerprint := config.SSHConfig{HostKey: ssh.FingerprintSHA256(ed25519Signer(t).PublicKey())}
+	if err := handshake(t, fingerprint, ed25519Key); err == nil {
+		t.Error("handshake with a mismatched fingerprint succeeded")
+	}
+}
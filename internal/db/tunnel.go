@@ -0,0 +1,291 @@
+package db
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/metrics"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	tunnelKeepaliveInterval = 15 * time.Second
+	tunnelKeepaliveTimeout  = 5 * time.Second
+	tunnelMinBackoff        = time.Second
+	tunnelMaxBackoff        = 30 * time.Second
+	acceptMaxBackoff        = time.Second
+)
+
+var errTunnelDown = errors.New("ssh tunnel is not connected")
+
+// Tunnel forwards connections accepted on an ephemeral local port to a
+// remote address through an SSH bastion. The SSH connection is kept alive
+// and re-established with backoff when it drops.
+type Tunnel struct {
+	cfg        config.SSHConfig
+	remoteAddr string
+	listener   net.Listener
+
+	mu        sync.Mutex
+	client    *ssh.Client
+	conns     map[net.Conn]struct{}
+	reconnect chan struct{}
+
+	wg        sync.WaitGroup
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTunnel connects to the bastion and starts forwarding to remoteAddr. The
+// first connection must succeed; later failures are retried in the background.
+func NewTunnel(cfg config.SSHConfig, remoteAddr string) (*Tunnel, error) {
+	client, err := dialSSH(cfg)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	t := &Tunnel{
+		cfg:        cfg,
+		remoteAddr: remoteAddr,
+		listener:   listener,
+		client:     client,
+		conns:      map[net.Conn]struct{}{},
+		reconnect:  make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	t.wg.Add(3)
+	go t.watch(client)
+	go t.acceptLoop()
+	go t.maintain()
+	return t, nil
+}
+
+// Addr returns the local host and port to connect to instead of remoteAddr.
+func (t *Tunnel) Addr() (string, int) {
+	addr := t.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Check sends a keepalive over the SSH connection.
+func (t *Tunnel) Check(ctx context.Context) error {
+	client := t.sshClient()
+	if client == nil {
+		return errTunnelDown
+	}
+	return keepalive(ctx, client)
+}
+
+// Close stops accepting, closes forwarded connections and the SSH connection,
+// and waits for all tunnel goroutines to exit.
+func (t *Tunnel) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.listener.Close()
+		t.mu.Lock()
+		for conn := range t.conns {
+			conn.Close()
+		}
+		if t.client != nil {
+			t.client.Close()
+			t.client = nil
+		}
+		t.mu.Unlock()
+	})
+	t.wg.Wait()
+	return nil
+}
+
+func (t *Tunnel) sshClient() *ssh.Client {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.client
+}
+
+// watch notices a dead SSH connection as soon as the transport closes,
+// without waiting for the next keepalive.
+func (t *Tunnel) watch(client *ssh.Client) {
+	defer t.wg.Done()
+	err := client.Wait()
+	t.markBroken(client, err)
+}
+
+// markBroken drops client if it is still the current one and wakes maintain.
+func (t *Tunnel) markBroken(client *ssh.Client, err error) {
+	t.mu.Lock()
+	if t.client != client {
+		t.mu.Unlock()
+		return
+	}
+	t.client = nil
+	t.mu.Unlock()
+	client.Close()
+	slog.Warn("ssh tunnel lost, reconnecting", "error", err)
+	select {
+	case t.reconnect <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Tunnel) acceptLoop() {
+	defer t.wg.Done()
+	var backoff time.Duration
+	for {
+		conn, err := t.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// Back off on errors such as running out of file descriptors
+			// instead of spinning.
+			backoff = min(max(backoff*2, 5*time.Millisecond), acceptMaxBackoff)
+			slog.Warn("ssh tunnel accept failed", "error", err, "retryIn", backoff)
+			select {
+			case <-t.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		t.mu.Lock()
+		select {
+		case <-t.done:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		go t.forward(conn)
+	}
+}
+
+func (t *Tunnel) forward(local net.Conn) {
+	metrics.TunnelConnOpened()
+	defer func() {
+		local.Close()
+		t.mu.Lock()
+		delete(t.conns, local)
+		t.mu.Unlock()
+		metrics.TunnelConnClosed()
+		t.wg.Done()
+	}()
+
+	client := t.sshClient()
+	if client == nil {
+		return
+	}
+	remote, err := client.Dial("tcp", t.remoteAddr)
+	if err != nil {
+		slog.Warn("ssh tunnel dial failed", "remote", t.remoteAddr, "error", err)
+		return
+	}
+	defer remote.Close()
+
+	// When either side finishes, close both so the other copy returns too.
+	copied := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		copied <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		copied <- struct{}{}
+	}()
+	<-copied
+	local.Close()
+	remote.Close()
+	<-copied
+}
+
+// maintain sends periodic keepalives and reconnects with exponential backoff
+// when the SSH connection is lost.
+func (t *Tunnel) maintain() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(tunnelKeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			client := t.sshClient()
+			if client == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), tunnelKeepaliveTimeout)
+			err := keepalive(ctx, client)
+			cancel()
+			if err != nil {
+				t.markBroken(client, err)
+			}
+		case <-t.reconnect:
+			t.redial()
+		}
+	}
+}
+
+func (t *Tunnel) redial() {
+	backoff := tunnelMinBackoff
+	for {
+		client, err := dialSSH(t.cfg)
+		metrics.TunnelReconnect(err)
+		if err == nil {
+			t.mu.Lock()
+			select {
+			case <-t.done:
+				t.mu.Unlock()
+				client.Close()
+				return
+			default:
+			}
+			t.client = client
+			t.wg.Add(1)
+			t.mu.Unlock()
+			go t.watch(client)
+			slog.Info("ssh tunnel reconnected")
+			return
+		}
+		slog.Warn("ssh tunnel reconnect failed", "error", err, "retryIn", backoff)
+		select {
+		case <-t.done:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, tunnelMaxBackoff)
+	}
+}
+
+func keepalive(ctx context.Context, client *ssh.Client) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func remoteAddr(cfg config.DatabaseConfig) string {
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
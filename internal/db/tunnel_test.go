@@ -0,0 +1,283 @@
+package db
+
+import (
+	"bufio"
+	"core-regulus-backend/internal/config"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer is a bastion that forwards direct-tcpip channels and can drop
+// every connection it holds, as a restarted sshd or a network blip would.
+type sshServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+}
+
+func startSSHServer(t *testing.T) *sshServer {
+	t.Helper()
+	hostKey := ed25519Signer(t)
+	s := &sshServer{
+		config: &ssh.ServerConfig{
+			PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+				return nil, nil
+			},
+		},
+		hostKey: hostKey.PublicKey(),
+	}
+	s.config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = listener
+	t.Cleanup(func() {
+		listener.Close()
+		s.drop()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepted++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if req.WantReply {
+				req.Reply(true, nil)
+			}
+		}
+	}()
+	for newChannel := range chans {
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+			newChannel.Reject(ssh.UnknownChannelType, "direct-tcpip only")
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelReqs, err := newChannel.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelReqs)
+		go func() {
+			io.Copy(remote, channel)
+			remote.Close()
+		}()
+		go func() {
+			io.Copy(channel, remote)
+			channel.Close()
+		}()
+	}
+}
+
+// drop closes every connection accepted so far; the server keeps listening.
+func (s *sshServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *sshServer) acceptedConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+func (s *sshServer) sshConfig(t *testing.T) config.SSHConfig {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.SSHConfig{
+		Host:       addr.IP.String(),
+		Port:       addr.Port,
+		User:       "tunnel",
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		HostKey:    string(ssh.MarshalAuthorizedKey(s.hostKey)),
+	}
+}
+
+// startEcho answers every line with the same line.
+func startEcho(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func dialTunnel(t *testing.T, tunnel *Tunnel) net.Conn {
+	t.Helper()
+	host, port := tunnel.Addr()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// roundTrip sends a line through conn and reports what came back.
+func roundTrip(conn net.Conn, line string) (string, error) {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	return reply[:max(len(reply)-1, 0)], err
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelForwards(t *testing.T) {
+	server := startSSHServer(t)
+	tunnel, err := NewTunnel(server.sshConfig(t), startEcho(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	if reply, err := roundTrip(dialTunnel(t, tunnel), "ping"); err != nil || reply != "ping" {
+		t.Fatalf("got %q, %v, want ping echoed", reply, err)
+	}
+}
+
+func TestTunnelReconnects(t *testing.T) {
+	server := startSSHServer(t)
+	tunnel, err := NewTunnel(server.sshConfig(t), startEcho(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+	before := tunnel.sshClient()
+
+	server.drop()
+	waitFor(t, "the tunnel to reconnect", func() bool {
+		client := tunnel.sshClient()
+		return client != nil && client != before
+	})
+	if n := server.acceptedConns(); n != 2 {
+		t.Errorf("server accepted %d connections, want the first and one reconnect", n)
+	}
+	if err := tunnel.Check(t.Context()); err != nil {
+		t.Errorf("Check after reconnecting: %v", err)
+	}
+	if reply, err := roundTrip(dialTunnel(t, tunnel), "after reconnect"); err != nil || reply != "after reconnect" {
+		t.Fatalf("got %q, %v, want the line echoed through the new connection", reply, err)
+	}
+}
+
+func TestTunnelCloseWithOpenConnections(t *testing.T) {
+	server := startSSHServer(t)
+	tunnel, err := NewTunnel(server.sshConfig(t), startEcho(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := []net.Conn{dialTunnel(t, tunnel), dialTunnel(t, tunnel)}
+	for _, conn := range conns {
+		if _, err := roundTrip(conn, "open"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		tunnel.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return with connections open")
+	}
+
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Error("forwarded connection is still open after Close")
+		}
+	}
+	host, port := tunnel.Addr()
+	if conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), time.Second); err == nil {
+		conn.Close()
+		t.Error("tunnel still accepts after Close")
+	}
+	if err := tunnel.Check(t.Context()); err == nil {
+		t.Error("Check succeeded after Close")
+	}
+	tunnel.Close()
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// configChannel is notified by the config.config trigger with the changed code.
+const configChannel = "config_changed"
+
+const (
+	watchMinBackoff = time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+// ConfigChange describes a reload of config.config.
+type ConfigChange struct {
+	Old  ConfigMap
+	New  ConfigMap
+	Keys []string
+}
+
+// Has reports whether any of keys changed.
+func (c ConfigChange) Has(keys ...string) bool {
+	for _, key := range keys {
+		if slices.Contains(c.Keys, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe registers fn to be called after every reload that changes at
+// least one key. Subscribers run sequentially on the watcher goroutine.
+func (d *DB) Subscribe(fn func(ConfigChange)) {
+	d.subscribersMu.Lock()
+	defer d.subscribersMu.Unlock()
+	d.subscribers = append(d.subscribers, fn)
+}
+
+// ReloadConfig reads config.config again, swaps it in and notifies
+// subscribers about the keys that changed.
+func (d *DB) ReloadConfig(ctx context.Context) error {
+	d.configMu.Lock()
+	// A replica may not have replayed the change yet when the notification
+	// arrives, so reloads always read from the primary.
+	res, err := d.loadConfig(ctx, d.Pool)
+	if err != nil {
+		d.configMu.Unlock()
+		return err
+	}
+	prev := d.dbConfig.Swap(&res)
+	d.configMu.Unlock()
+	if prev == nil {
+		return nil
+	}
+	old := *prev
+	keys := changedKeys(old, res)
+	if len(keys) == 0 {
+		return nil
+	}
+	slog.Info("config reloaded", "keys", keys)
+
+	d.subscribersMu.Lock()
+	subscribers := slices.Clone(d.subscribers)
+	d.subscribersMu.Unlock()
+	change := ConfigChange{Old: old, New: res, Keys: keys}
+	for _, fn := range subscribers {
+		fn(change)
+	}
+	return nil
+}
+
+func changedKeys(old, cur ConfigMap) []string {
+	var keys []string
+	for key, val := range cur {
+		if prev, ok := old[key]; !ok || !reflect.DeepEqual(prev, val) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range old {
+		if _, ok := cur[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// WatchConfig starts listening for config.config changes in the background.
+// Close stops the watcher.
+func (d *DB) WatchConfig() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.watchCancel = cancel
+	d.watchDone = make(chan struct{})
+	go func() {
+		defer close(d.watchDone)
+		backoff := watchMinBackoff
+		for {
+			err := d.listen(ctx, func() { backoff = watchMinBackoff })
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("config watcher disconnected, retrying", "error", err, "retryIn", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, watchMaxBackoff)
+		}
+	}()
+}
+
+// listen holds a dedicated connection subscribed to configChannel until it
+// fails. Changes made while the watcher was disconnected are picked up by the
+// reload that follows every successful LISTEN.
+func (d *DB) listen(ctx context.Context, connected func()) error {
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{configChannel}.Sanitize()); err != nil {
+		conn.Conn().Close(context.Background())
+		return err
+	}
+	connected()
+	if err := d.ReloadConfig(ctx); err != nil {
+		slog.Error("config reload failed", "error", err)
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			// The session is still subscribed; don't hand it back to the pool.
+			conn.Conn().Close(context.Background())
+			return err
+		}
+		slog.Debug("config change notified", "code", notification.Payload)
+		if err := d.ReloadConfig(ctx); err != nil {
+			slog.Error("config reload failed", "error", err)
+		}
+	}
+}
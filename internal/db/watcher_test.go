@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/secrets"
+	"core-regulus-backend/internal/testenv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool is the database of the tests calling testenv.RequirePostgres.
+var testPool *pgxpool.Pool
+
+func TestMain(m *testing.M) {
+	pg := testenv.PostgresForTests(context.Background())
+	if pg == nil {
+		os.Exit(m.Run())
+	}
+	var err error
+	testPool, err = pgxpool.New(context.Background(), pg.URL)
+	if err != nil {
+		fmt.Println(err)
+		pg.Stop()
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	testPool.Close()
+	pg.Stop()
+	os.Exit(code)
+}
+
+func TestChangedKeys(t *testing.T) {
+	old := ConfigMap{
+		"same":    "a",
+		"changed": map[string]any{"max": 3.0},
+		"deleted": true,
+	}
+	cur := ConfigMap{
+		"same":    "a",
+		"changed": map[string]any{"max": 4.0},
+		"added":   1.0,
+	}
+	if got, want := changedKeys(old, cur), []string{"added", "changed", "deleted"}; !slices.Equal(got, want) {
+		t.Errorf("changedKeys = %v, want %v", got, want)
+	}
+	if got := changedKeys(cur, cur); got != nil {
+		t.Errorf("changedKeys of equal maps = %v", got)
+	}
+}
+
+func keyring(t *testing.T) *secrets.Keyring {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := secrets.NewKeyring(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func setConfig(t *testing.T, code string, value any) {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testPool.Exec(context.Background(), "select config.set($1, $2)", code, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deleteConfig(t *testing.T, code string) {
+	t.Helper()
+	if _, err := testPool.Exec(context.Background(), "delete from config.config where code = $1", code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	t.Cleanup(func() { testPool.Exec(ctx, "delete from config.config") })
+
+	k := keyring(t)
+	d := &DB{Pool: testPool, cfg: config.DatabaseConfig{QueryTimeout: 5 * time.Second}, keyring: k}
+	var changes []ConfigChange
+	d.Subscribe(func(c ConfigChange) { changes = append(changes, c) })
+
+	setConfig(t, "kept", "a")
+	setConfig(t, "changed", 1)
+	setConfig(t, "deleted", true)
+	if err := d.ReloadConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("the first load notified %v", changes)
+	}
+
+	setConfig(t, "changed", 2)
+	deleteConfig(t, "deleted")
+	if err := d.ReloadConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(changes))
+	}
+	change := changes[0]
+	if want := []string{"changed", "deleted"}; !slices.Equal(change.Keys, want) {
+		t.Errorf("keys = %v, want %v", change.Keys, want)
+	}
+	if !change.Has("deleted") || change.Has("kept") {
+		t.Errorf("Has disagrees with keys %v", change.Keys)
+	}
+	if change.Old["changed"] != 1.0 || change.New["changed"] != 2.0 {
+		t.Errorf("changed: old %v, new %v", change.Old["changed"], change.New["changed"])
+	}
+	if _, ok := change.New["deleted"]; ok || change.Old["deleted"] != true {
+		t.Errorf("deleted: old %v, new %v", change.Old["deleted"], change.New["deleted"])
+	}
+
+	if err := d.ReloadConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("a reload without changes notified %v", changes[1:])
+	}
+
+	// A value sealed with a master key the service doesn't have can't be
+	// decrypted; the previous configuration stays in effect.
+	e, err := keyring(t).Encrypt("secret", []byte(`"hunter2"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setConfig(t, "secret", e.Value())
+	if err := d.ReloadConfig(ctx); !errors.Is(err, secrets.ErrUnknownKey) {
+		t.Fatalf("ReloadConfig = %v, want ErrUnknownKey", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("a failed reload notified %v", changes[1:])
+	}
+	cfg, err := d.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, change.New) {
+		t.Errorf("config after a failed reload = %v, want %v", cfg, change.New)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package deadline
+
+import (
+	"context"
+	"net"
+)
+
+// watchConn doesn't detect disconnects on this platform; requests run until
+// they finish or hit their deadline.
+func watchConn(ctx context.Context, _ net.Conn) (context.Context, func()) {
+	return ctx, func() {}
+}
@@ -0,0 +1,55 @@
+//go:build linux || darwin
+
+package deadline
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchConn returns a context cancelled with ErrClientGone once the client
+// closes conn. fasthttp reads the whole request before calling the handler and
+// doesn't read again until it returns, so the watcher only peeks: a pipelined
+// request stays in the socket for fasthttp. stop must be called before the
+// handler returns.
+func watchConn(ctx context.Context, conn net.Conn) (context.Context, func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		// TLS or the in-memory connections of app.Test.
+		return ctx, func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return ctx, func() {}
+	}
+	// The read deadline fasthttp set for the request would stop the watcher
+	// early; fasthttp sets it again before reading the next request.
+	conn.SetReadDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var buf [1]byte
+		raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			switch {
+			case err == syscall.EAGAIN || err == syscall.EINTR:
+				return false
+			case err == nil && n == 0, err == syscall.ECONNRESET:
+				cancel(ErrClientGone)
+			}
+			return true
+		})
+	}()
+	return ctx, func() {
+		// Wake the watcher and wait for it, so it never races fasthttp for
+		// the next request.
+		conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		conn.SetReadDeadline(time.Time{})
+		cancel(nil)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build linux || darwin
+
+package deadline
+
+import (
+	"bufio"
+	"context"
+	"core-regulus-backend/internal/problem"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// serve runs an app behind Middleware on a real listener; /wait blocks until
+// the request context ends and reports its cause and the response status.
+func serve(t *testing.T) (addr string, causes chan error, statuses chan int) {
+	t.Helper()
+	causes, statuses = make(chan error, 1), make(chan int, 1)
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+		ReadTimeout:           50 * time.Millisecond,
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			statuses <- problem.From(err).Status
+			return problem.ErrorHandler(c, err)
+		},
+	})
+	app.Use(Middleware(5 * time.Second))
+	app.Get("/wait", func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	app.Get("/sleep", func(c *fiber.Ctx) error {
+		select {
+		case <-c.UserContext().Done():
+			return c.UserContext().Err()
+		case <-time.After(100 * time.Millisecond):
+			return c.SendString("done")
+		}
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+	return listener.Addr().String(), causes, statuses
+}
+
+func TestDisconnectCancelsRequest(t *testing.T) {
+	addr, causes, statuses := serve(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "GET /wait HTTP/1.1\r\nHost: test\r\n\r\n")
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case cause := <-causes:
+		if cause != ErrClientGone {
+			t.Errorf("cause = %v, want ErrClientGone", cause)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context was not cancelled after the client left")
+	}
+	if status := <-statuses; status != problem.StatusClientClosedRequest {
+		t.Errorf("status = %d, want 499", status)
+	}
+}
+
+func TestKeepAliveAfterWatching(t *testing.T) {
+	addr, _, _ := serve(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// The handler outlives the read timeout, and the second request is
+	// already waiting in the socket while the first one runs.
+	io.WriteString(conn, "GET /sleep HTTP/1.1\r\nHost: test\r\n\r\nGET /sleep HTTP/1.1\r\nHost: test\r\n\r\n")
+	for i := range 2 {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "done" {
+			t.Fatalf("request %d: status %d: %s", i+1, resp.StatusCode, body)
+		}
+	}
+}
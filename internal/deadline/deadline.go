@@ -0,0 +1,28 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrClientGone is the cause of a request context cancelled because the
+// client closed the connection.
+var ErrClientGone = errors.New("client closed the connection")
+
+// Middleware bounds the request's user context by timeout, so every database
+// and Google call made on behalf of the request is cancelled once it expires.
+// The context is also cancelled when the client closes the connection before
+// the response is written.
+func Middleware(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		ctx, stop := watchConn(ctx, c.Context().Conn())
+		defer stop()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
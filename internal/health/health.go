@@ -0,0 +1,100 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const checkTimeout = 3 * time.Second
+
+type Checker func(ctx context.Context) error
+
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type ReadyResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// Registry holds the dependency checks reported by /readyz.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Checker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{checks: map[string]Checker{}}
+}
+
+// Register adds a dependency check to /readyz. Registering the same name again replaces the check.
+func (r *Registry) Register(name string, check Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+func (r *Registry) runChecks(ctx context.Context) ReadyResponse {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	checks := r.checks
+
+	res := ReadyResponse{
+		Status: "ok",
+		Checks: make(map[string]CheckStatus, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			status := CheckStatus{
+				Status:   "ok",
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				status.Status = "unavailable"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = status
+			if err != nil {
+				res.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
+
+func getHealthzHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+func (r *Registry) getReadyzHandler(c *fiber.Ctx) error {
+	res := r.runChecks(c.UserContext())
+	if res.Status != "ok" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(res)
+	}
+	return c.JSON(res)
+}
+
+func InitRoutes(app *fiber.App, r *Registry) {
+	app.Get("/healthz", getHealthzHandler)
+	app.Get("/readyz", r.getReadyzHandler)
+}
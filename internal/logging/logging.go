@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are never written to the log.
+var secretKeys = map[string]bool{
+	"authorization": true,
+	"token":         true,
+	"jwt":           true,
+	"password":      true,
+	"privatekey":    true,
+}
+
+// emailKeys are written with the local part masked.
+var emailKeys = map[string]bool{
+	"email":      true,
+	"guestemail": true,
+}
+
+type ctxKey struct{}
+
+// Setup installs the default slog logger. format is "json" or "text".
+func Setup(level slog.Level, format string) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+	var handler slog.Handler
+	if format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+var (
+	jwtPattern   = regexp.MustCompile(`eyJ[\w-]*\.[\w-]*\.[\w-]*`)
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+)
+
+// redact is called by the handler for every attribute, including the ones
+// nested in groups, so keys are matched regardless of the group they are in.
+// Errors have tokens and email addresses scrubbed from their message.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if secretKeys[key] {
+		return slog.String(a.Key, redacted)
+	}
+	if err, ok := a.Value.Any().(error); ok && a.Value.Kind() == slog.KindAny {
+		return slog.String(a.Key, scrub(err.Error()))
+	}
+	if emailKeys[key] {
+		return slog.String(a.Key, MaskEmail(a.Value.String()))
+	}
+	return a
+}
+
+// scrub hides JWTs and masks email addresses found in free text.
+func scrub(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// MaskEmail keeps the first character of the local part and the domain.
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return redacted
+	}
+	return local[:1] + "***@" + domain
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the request logger stored in ctx, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// Fatal logs at error level and exits; it is meant for startup failures only.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// Middleware assigns every request an ID, taken from X-Request-ID when the
+// caller sends one, echoes it back, and stores a logger carrying it in the
+// request's user context. It logs one line per completed request.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+
+	requestID := c.Get(RequestIDHeader)
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		requestID = uuid.NewString()
+	}
+	c.Set(RequestIDHeader, requestID)
+	c.Locals("requestId", requestID)
+
+	ctx := c.UserContext()
+	logger := slog.Default().With("requestId", requestID)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With("traceId", sc.TraceID().String())
+	}
+	c.SetUserContext(WithLogger(ctx, logger))
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	level := slog.LevelInfo
+	if status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.Log(c.UserContext(), level, "request",
+		"method", c.Method(),
+		"path", c.Path(),
+		"route", c.Route().Path,
+		"status", status,
+		"durationMs", float64(time.Since(start).Microseconds())/1000,
+	)
+	return err
+}
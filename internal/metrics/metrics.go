@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "core_regulus"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	googleCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "google_calendar",
+		Name:      "calls_total",
+		Help:      "Google Calendar API calls by method and result.",
+	}, []string{"method", "result"})
+
+	googleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "google_calendar",
+		Name:      "call_duration_seconds",
+		Help:      "Google Calendar API call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	bookings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bookings_total",
+		Help:      "Booking attempts by result and error code.",
+	}, []string{"result", "code"})
+
+	tunnelConnections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ssh_tunnel",
+		Name:      "connections_total",
+		Help:      "Connections forwarded through the SSH tunnel.",
+	})
+
+	tunnelActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ssh_tunnel",
+		Name:      "active_connections",
+		Help:      "Connections currently forwarded through the SSH tunnel.",
+	})
+
+	tunnelReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ssh_tunnel",
+		Name:      "reconnects_total",
+		Help:      "SSH tunnel reconnection attempts by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		googleCalls,
+		googleDuration,
+		bookings,
+		tunnelConnections,
+		tunnelActive,
+		tunnelReconnects,
+	)
+}
+
+// Middleware records request count and latency labelled by the matched
+// route pattern rather than the raw path, to keep cardinality bounded.
+// Errors are rendered here so the recorded status is the one sent.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	if err := c.Next(); err != nil {
+		if err := c.App().ErrorHandler(c, err); err != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	status := c.Response().StatusCode()
+	route := c.Route().Path
+	labels := prometheus.Labels{
+		"method": c.Method(),
+		"route":  route,
+		"status": strconv.Itoa(status),
+	}
+	httpRequests.With(labels).Inc()
+	httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func ObserveGoogleCall(method string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	googleCalls.WithLabelValues(method, result).Inc()
+	googleDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func BookingSucceeded() {
+	bookings.WithLabelValues("success", "").Inc()
+}
+
+func BookingFailed(code string) {
+	bookings.WithLabelValues("failure", code).Inc()
+}
+
+func TunnelConnOpened() {
+	tunnelConnections.Inc()
+	tunnelActive.Inc()
+}
+
+func TunnelConnClosed() {
+	tunnelActive.Dec()
+}
+
+func TunnelReconnect(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	tunnelReconnects.WithLabelValues(result).Inc()
+}
+
+func Register(c prometheus.Collector) error {
+	return registry.Register(c)
+}
+
+func Unregister(c prometheus.Collector) {
+	registry.Unregister(c)
+}
+
+func InitRoutes(app *fiber.App) {
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+}
@@ -0,0 +1,182 @@
+package problem
+
+import (
+	"context"
+	"core-regulus-backend/internal/logging"
+	"core-regulus-backend/internal/validation"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/puddle/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ContentType = "application/problem+json"
+
+// StatusClientClosedRequest is the nginx convention for a request the client
+// abandoned before the response was written.
+const StatusClientClosedRequest = 499
+
+const (
+	CodeInvalidBody         = "invalid_body"
+	CodeValidationFailed    = "validation_failed"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeConflict            = "conflict"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeTimeout             = "timeout"
+	CodeClientClosed        = "client_closed_request"
+	CodeInternal            = "internal_error"
+)
+
+// Problem is an RFC 7807 problem detail. Code is a stable machine-readable
+// identifier clients can switch on; Type is derived from it.
+type Problem struct {
+	Type     string                     `json:"type"`
+	Title    string                     `json:"title"`
+	Status   int                        `json:"status"`
+	Code     string                     `json:"code"`
+	Detail   string                     `json:"detail,omitempty"`
+	Instance string                     `json:"instance,omitempty"`
+	Errors   []validation.ErrorResponse `json:"errors,omitempty"`
+	cause    error
+}
+
+func New(status int, code string, title string) *Problem {
+	return &Problem{
+		Type:   "urn:core-regulus:problem:" + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Is reports problems with the same code as equal, so copies made by
+// WithDetail and Wrap still match their sentinel.
+func (p *Problem) Is(target error) bool {
+	t, ok := target.(*Problem)
+	return ok && t.Code == p.Code
+}
+
+func (p *Problem) WithDetail(detail string) *Problem {
+	res := *p
+	res.Detail = detail
+	return &res
+}
+
+// Wrap attaches the underlying error. It is logged for server errors but
+// never sent to the client.
+func (p *Problem) Wrap(err error) *Problem {
+	res := *p
+	res.cause = err
+	return &res
+}
+
+var (
+	ErrInvalidBody         = New(fiber.StatusBadRequest, CodeInvalidBody, "Cannot parse request body")
+	ErrValidationFailed    = New(fiber.StatusBadRequest, CodeValidationFailed, "Request validation failed")
+	ErrUnauthorized        = New(fiber.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+	ErrForbidden           = New(fiber.StatusForbidden, CodeForbidden, "Forbidden")
+	ErrUpstreamUnavailable = New(fiber.StatusServiceUnavailable, CodeUpstreamUnavailable, "Upstream service is unavailable")
+	ErrInternal            = New(fiber.StatusInternalServerError, CodeInternal, "Internal server error")
+	ErrTimeout             = New(fiber.StatusGatewayTimeout, CodeTimeout, "Request timed out")
+	ErrClientClosed        = New(StatusClientClosedRequest, CodeClientClosed, "Client closed request")
+)
+
+func Validation(errs []validation.ErrorResponse) *Problem {
+	res := *ErrValidationFailed
+	res.Errors = errs
+	return &res
+}
+
+func codeFromStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeInvalidBody
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusServiceUnavailable:
+		return CodeUpstreamUnavailable
+	}
+	return CodeInternal
+}
+
+// databaseUnavailable reports whether err means no database connection could
+// be had: the server refused or didn't answer, or the pool is closed.
+func databaseUnavailable(err error) bool {
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || errors.Is(err, puddle.ErrClosedPool)
+}
+
+// From converts any error returned by a handler into a Problem; anything
+// unrecognised becomes an opaque internal error. A deadline, cancellation or
+// unreachable database wins over the problem that wraps it, since it explains
+// the failure.
+func From(err error) *Problem {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout.Wrap(err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrClientClosed.Wrap(err)
+	}
+	if databaseUnavailable(err) {
+		return ErrUpstreamUnavailable.Wrap(err)
+	}
+
+	var p *Problem
+	if errors.As(err, &p) {
+		res := *p
+		return &res
+	}
+
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		res := New(fe.Code, codeFromStatus(fe.Code), utils.StatusMessage(fe.Code))
+		if fe.Message != res.Title {
+			res.Detail = fe.Message
+		}
+		return res
+	}
+
+	return ErrInternal.Wrap(err)
+}
+
+// ErrorHandler renders err as a problem. It records err on the request span
+// itself, because metrics.Middleware renders errors before
+// tracing.Middleware sees them.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	trace.SpanFromContext(c.UserContext()).RecordError(err)
+	p := From(err)
+	if p.Status >= fiber.StatusInternalServerError {
+		logger := logging.FromContext(c.UserContext()).With("code", p.Code, "status", p.Status)
+		if cause := p.Unwrap(); cause != nil {
+			logger = logger.With("error", cause)
+		}
+		logger.Error(p.Error())
+	}
+	p.Instance = c.Path()
+	return c.Status(p.Status).JSON(p, ContentType)
+}
@@ -0,0 +1,106 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// unusedAddr returns an address nothing listens on, so connecting fails fast.
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func databaseErrors(t *testing.T) (connect, acquire, closed error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "postgres://app@" + unusedAddr(t) + "/app?sslmode=disable&connect_timeout=5"
+
+	if conn, err := pgconn.Connect(ctx, url); err == nil {
+		conn.Close(ctx)
+		t.Fatal("connected to an unused port")
+	} else {
+		connect = err
+	}
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatal("acquired a connection to an unused port")
+	} else {
+		acquire = err
+	}
+	pool.Close()
+	if _, err := pool.Acquire(ctx); err == nil {
+		t.Fatal("acquired a connection from a closed pool")
+	} else {
+		closed = err
+	}
+	return connect, acquire, closed
+}
+
+func TestFrom(t *testing.T) {
+	connect, acquire, closed := databaseErrors(t)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"problem", ErrForbidden.WithDetail("hosts only"), fiber.StatusForbidden, CodeForbidden},
+		{"fiber error", fiber.ErrNotFound, fiber.StatusNotFound, CodeNotFound},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), fiber.StatusGatewayTimeout, CodeTimeout},
+		{"cancelled", ErrInternal.Wrap(context.Canceled), StatusClientClosedRequest, CodeClientClosed},
+		{"connect", connect, fiber.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{"pool acquire", fmt.Errorf("query config: %w", acquire), fiber.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{"closed pool", closed, fiber.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{"wrapped connect", ErrInternal.Wrap(connect), fiber.StatusServiceUnavailable, CodeUpstreamUnavailable},
+		{"other", errors.New("boom"), fiber.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		p := From(tt.err)
+		if p.Status != tt.status || p.Code != tt.code {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, p.Status, p.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestErrorHandlerDatabaseUnavailable(t *testing.T) {
+	connect, _, _ := databaseErrors(t)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error { return connect })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var p Problem
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable || p.Code != CodeUpstreamUnavailable || p.Detail != "" {
+		t.Errorf("got %d %s, want 503 upstream_unavailable without details", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BookingFilter selects bookings; zero fields don't filter. From and To bound
+// the meeting start time, To exclusively. A zero Limit means no limit.
+type BookingFilter struct {
+	From        time.Time
+	To          time.Time
+	Status      string
+	GuestEmail  string
+	MeetingType string
+	UserID      string
+	Limit       int
+	Offset      int
+}
+
+// where builds the filter condition and its arguments.
+func (f BookingFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if !f.From.IsZero() {
+		add("time_start >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("time_start < ?", f.To)
+	}
+	if f.Status != "" {
+		add("status = ?::service.booking_status", f.Status)
+	}
+	if f.GuestEmail != "" {
+		add("lower(guest_email) = lower(?)", f.GuestEmail)
+	}
+	if f.MeetingType != "" {
+		add("meeting_type = ?", f.MeetingType)
+	}
+	if f.UserID != "" {
+		add("user_id = ?::uuid", f.UserID)
+	}
+	if len(conds) == 0 {
+		return "true", nil
+	}
+	return strings.Join(conds, " and "), args
+}
+
+// query selects the page of matching bookings, latest meeting first.
+func (f BookingFilter) query() (string, []any) {
+	where, args := f.where()
+	sql := "select " + bookingColumns + " from service.bookings where " + where + " order by time_start desc, id"
+	if f.Limit > 0 {
+		sql += " limit " + strconv.Itoa(f.Limit)
+	}
+	if f.Offset > 0 {
+		sql += " offset " + strconv.Itoa(f.Offset)
+	}
+	return sql, args
+}
+
+const bookingColumns = `
+	id::text, create_time, status::text, cancel_time, coalesce(cancel_reason, ''),
+	coalesce(user_id::text, ''), coalesce(event_id, ''), coalesce(meeting_type, ''), time_start, time_end,
+	guest_email, coalesce(guest_name, ''), coalesce(description, ''), answers`
+
+func scanBooking(row pgx.CollectableRow) (Booking, error) {
+	var b Booking
+	err := row.Scan(
+		&b.ID, &b.CreateTime, &b.Status, &b.CancelTime, &b.CancelReason,
+		&b.UserID, &b.EventID, &b.MeetingType, &b.TimeStart, &b.TimeEnd,
+		&b.GuestEmail, &b.GuestName, &b.Description, &b.Answers,
+	)
+	return b, err
+}
+
+// Bookings returns a page of the bookings matching f, latest meeting first,
+// and the number of matching bookings.
+func (r *Repository) Bookings(ctx context.Context, f BookingFilter) ([]Booking, int, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	where, args := f.where()
+	var total int
+	err := r.db.Reader().QueryRow(ctx, "select count(*) from service.bookings where "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sql, args := f.query()
+	rows, err := r.db.Reader().Query(ctx, sql, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	bookings, err := pgx.CollectRows(rows, scanBooking)
+	return bookings, total, err
+}
+
+// EachBooking calls fn for every booking matching f, in Bookings order, as
+// rows are read. f.Limit and f.Offset are honoured. Only the request context
+// bounds it, since exports can be large.
+func (r *Repository) EachBooking(ctx context.Context, f BookingFilter, fn func(Booking) error) error {
+	sql, args := f.query()
+	rows, err := r.db.Reader().Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		b, err := scanBooking(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Booking returns the booking with id, or ErrNotFound.
+func (r *Repository) Booking(ctx context.Context, id string) (*Booking, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Pool.Query(ctx, "select "+bookingColumns+" from service.bookings where id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := pgx.CollectExactlyOneRow(rows, scanBooking)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// CancelBooking marks a confirmed booking cancelled and returns it; ErrNotFound
+// when there is no confirmed booking with id. beforeCommit, if set, runs while
+// the booking is locked; an error from it leaves the booking confirmed.
+func (r *Repository) CancelBooking(ctx context.Context, id, reason string, beforeCommit func(Booking) error) (*Booking, error) {
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	queryCtx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+	rows, err := tx.Query(queryCtx, `
+		update service.bookings
+		   set status = 'cancelled', cancel_time = now(), cancel_reason = $2
+		 where id = $1 and status = 'confirmed'
+		returning `+bookingColumns, id, nullIfEmpty(reason))
+	if err != nil {
+		return nil, err
+	}
+	b, err := pgx.CollectExactlyOneRow(rows, scanBooking)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if beforeCommit != nil {
+		if err := beforeCommit(b); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
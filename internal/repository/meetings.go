@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type Question struct {
+	Code     string
+	Label    string
+	Kind     string
+	Required bool
+	Options  []string
+	Rules    string
+}
+
+type MeetingType struct {
+	Code      string
+	Name      string
+	Questions []Question
+}
+
+const (
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+)
+
+// Booking is a row of service.bookings. ID, CreateTime, Status and the
+// cancellation fields are set by the database.
+type Booking struct {
+	ID           string
+	CreateTime   time.Time
+	Status       string
+	CancelTime   *time.Time
+	CancelReason string
+
+	// UserID is the signed-in user who booked, if any.
+	UserID      string
+	EventID     string
+	MeetingType string
+	TimeStart   time.Time
+	TimeEnd     time.Time
+	GuestEmail  string
+	GuestName   string
+	Description string
+	Answers     map[string]any
+}
+
+// MeetingType returns the meeting type with its questions in display order,
+// or ErrNotFound.
+func (r *Repository) MeetingType(ctx context.Context, code string) (*MeetingType, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+	q := r.db.Reader()
+
+	mt := MeetingType{Questions: []Question{}}
+	err := q.QueryRow(ctx, `
+		select code, name
+		  from service.meeting_types
+		 where code = $1`, code).Scan(&mt.Code, &mt.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `
+		select code, label, kind::text, required, options, coalesce(rules, '')
+		  from service.meeting_questions
+		 where meeting_type = $1
+		 order by sort_order, code`, code)
+	if err != nil {
+		return nil, err
+	}
+	mt.Questions, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Question, error) {
+		var question Question
+		err := row.Scan(&question.Code, &question.Label, &question.Kind, &question.Required, &question.Options, &question.Rules)
+		return question, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &mt, nil
+}
+
+// AddBooking records a booking made in Google Calendar and returns its id. A
+// UserID that isn't a user id or no longer exists is dropped rather than
+// failing the booking.
+func (r *Repository) AddBooking(ctx context.Context, b Booking) (string, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if uuid.Validate(b.UserID) != nil {
+		// Tokens issued before users had ids carry none.
+		b.UserID = ""
+	}
+	answers := b.Answers
+	if answers == nil {
+		answers = map[string]any{}
+	}
+	var id string
+	err := r.db.Pool.QueryRow(ctx, `
+		insert into service.bookings (
+			event_id, meeting_type, time_start, time_end,
+			guest_email, guest_name, description, answers, user_id
+		)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, (select id from users.users where id = $9::uuid))
+		returning id::text`,
+		nullIfEmpty(b.EventID), nullIfEmpty(b.MeetingType), b.TimeStart, b.TimeEnd,
+		b.GuestEmail, nullIfEmpty(b.GuestName), nullIfEmpty(b.Description), answers, nullIfEmpty(b.UserID),
+	).Scan(&id)
+	return id, err
+}
+
+// nullIfEmpty mirrors shared.set_null_if_empty for query parameters.
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
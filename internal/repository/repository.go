@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"core-regulus-backend/internal/db"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotFound is returned when a single-row lookup matches nothing.
+var ErrNotFound = errors.New("not found")
+
+// Repository runs typed queries: reads go to db.Reader, writes to the primary,
+// and every call is bounded by the configured query timeout.
+type Repository struct {
+	db *db.DB
+}
+
+func New(database *db.DB) *Repository {
+	return &Repository{db: database}
+}
+
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// DaySlots are the schedule slots of one date, in start order.
+type DaySlots struct {
+	Date  time.Time
+	Slots []Interval
+}
+
+// TimeSlot is a row of service.meeting_time_slots.
+type TimeSlot struct {
+	ID        string
+	DayOfWeek string
+	TimeStart time.Duration
+	Duration  time.Duration
+}
+
+type Attendee struct {
+	Name  string
+	Email string
+}
+
+// FreeSlots expands the weekly schedule into slots for every date between
+// from and to, skipping blackout dates and slots that have already started.
+func (r *Repository) FreeSlots(ctx context.Context, from, to time.Time) ([]DaySlots, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		select d.date,
+		       d.date + s.time_start as slot_start,
+		       d.date + s.time_start + s.duration as slot_end
+		  from service.get_days($1, $2) d
+		  join service.meeting_time_slots s on s.day_of_week = d.day_of_week
+		 where d.date + s.time_start > now()
+		   and not exists (select 1 from service.blackout_dates b where b.date = d.date)
+		 order by slot_start`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []DaySlots
+	for rows.Next() {
+		var date time.Time
+		var slot Interval
+		if err := rows.Scan(&date, &slot.Start, &slot.End); err != nil {
+			return nil, err
+		}
+		if n := len(res); n == 0 || !res[n-1].Date.Equal(date) {
+			res = append(res, DaySlots{Date: date})
+		}
+		last := &res[len(res)-1]
+		last.Slots = append(last.Slots, slot)
+	}
+	return res, rows.Err()
+}
+
+// TargetSlot returns the schedule slot that starts exactly at start, or
+// ErrNotFound when there is none, start is in the past or on a blackout date.
+func (r *Repository) TargetSlot(ctx context.Context, start time.Time) (*TimeSlot, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var slot TimeSlot
+	err := r.db.Reader().QueryRow(ctx, `
+		select id::text, day_of_week::text, time_start, duration
+		  from service.meeting_time_slots
+		 where day_of_week = lower(to_char($1::timestamptz, 'FMDay'))::service.day_of_week
+		   and $1::timestamptz::time::interval = time_start
+		   and $1::timestamptz > now()
+		   and not exists (select 1 from service.blackout_dates b where b.date = $1::timestamptz::date)
+		 limit 1`, start).Scan(&slot.ID, &slot.DayOfWeek, &slot.TimeStart, &slot.Duration)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// Attendees returns the hosts invited to every meeting.
+func (r *Repository) Attendees(ctx context.Context) ([]Attendee, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		select coalesce(name, ''), email
+		  from service.meeting_attendees
+		 order by name, email`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Attendee, error) {
+		var a Attendee
+		err := row.Scan(&a.Name, &a.Email)
+		return a, err
+	})
+}
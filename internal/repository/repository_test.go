@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/db"
+	"core-regulus-backend/internal/testenv"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// These tests run against the database in TEST_DATABASE_URL, or an embedded
+// Postgres when it is not set; see testenv.PostgresForTests.
+var (
+	testPool *pgxpool.Pool
+	testRepo *Repository
+)
+
+func TestMain(m *testing.M) {
+	pg := testenv.PostgresForTests(context.Background())
+	if pg == nil {
+		os.Exit(m.Run())
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(pg.URL)
+	if err != nil {
+		fmt.Println(err)
+		pg.Stop()
+		os.Exit(1)
+	}
+	poolConfig.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	testPool, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		fmt.Println(err)
+		pg.Stop()
+		os.Exit(1)
+	}
+	testRepo = New(db.New(testPool, config.DatabaseConfig{QueryTimeout: 5 * time.Second}))
+
+	code := m.Run()
+	testPool.Close()
+	pg.Stop()
+	os.Exit(code)
+}
+
+func exec(t *testing.T, sql string, args ...any) {
+	t.Helper()
+	if _, err := testPool.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+}
+
+// addSlot schedules a slot on the weekday of day and returns when it starts on day.
+func addSlot(t *testing.T, day time.Time, start, duration time.Duration) time.Time {
+	t.Helper()
+	var id string
+	err := testPool.QueryRow(context.Background(), `
+		insert into service.meeting_time_slots (day_of_week, time_start, duration)
+		values (lower(to_char($1::date, 'FMDay'))::service.day_of_week, $2, $3)
+		returning id::text`, day, start, duration).Scan(&id)
+	if err != nil {
+		t.Fatalf("add slot: %v", err)
+	}
+	t.Cleanup(func() {
+		testPool.Exec(context.Background(), "delete from service.meeting_time_slots where id = $1", id)
+	})
+	return day.Add(start)
+}
+
+func tomorrow() time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+}
+
+func TestFreeSlots(t *testing.T) {
+	testenv.RequirePostgres(t)
+	day := tomorrow()
+	start := addSlot(t, day, 3*time.Hour+17*time.Minute, 45*time.Minute)
+
+	days, err := testRepo.FreeSlots(context.Background(), day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || !days[0].Date.Equal(day) {
+		t.Fatalf("got days %v, want only %s", days, day)
+	}
+	want := Interval{Start: start, End: start.Add(45 * time.Minute)}
+	for _, slot := range days[0].Slots {
+		if slot.Start.Equal(want.Start) && slot.End.Equal(want.End) {
+			return
+		}
+	}
+	t.Fatalf("slot %v not in %v", want, days[0].Slots)
+}
+
+func TestTargetSlot(t *testing.T) {
+	testenv.RequirePostgres(t)
+	start := addSlot(t, tomorrow(), 3*time.Hour+17*time.Minute, 45*time.Minute)
+
+	slot, err := testRepo.TargetSlot(context.Background(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot.Duration != 45*time.Minute || slot.TimeStart != 3*time.Hour+17*time.Minute {
+		t.Fatalf("got start %s duration %s, want 3h17m and 45m", slot.TimeStart, slot.Duration)
+	}
+
+	_, err = testRepo.TargetSlot(context.Background(), start.Add(time.Minute))
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMeetingType(t *testing.T) {
+	testenv.RequirePostgres(t)
+	exec(t, "insert into service.meeting_types (code, name) values ('test-intro', 'Intro')")
+	t.Cleanup(func() {
+		testPool.Exec(context.Background(), "delete from service.meeting_types where code = 'test-intro'")
+	})
+	exec(t, `insert into service.meeting_questions (meeting_type, code, label, kind, required, options, sort_order)
+		values ('test-intro', 'budget', 'Budget', 'select', true, '["small", "large"]', 2),
+		       ('test-intro', 'company', 'Company', 'text', false, null, 1)`)
+
+	mt, err := testRepo.MeetingType(context.Background(), "test-intro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt.Name != "Intro" || len(mt.Questions) != 2 {
+		t.Fatalf("got %+v", mt)
+	}
+	if q := mt.Questions[0]; q.Code != "company" || q.Options != nil || q.Rules != "" {
+		t.Fatalf("first question %+v, want company without options", q)
+	}
+	if q := mt.Questions[1]; q.Code != "budget" || !q.Required || len(q.Options) != 2 {
+		t.Fatalf("second question %+v, want required budget with two options", q)
+	}
+
+	_, err = testRepo.MeetingType(context.Background(), "test-missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestAddBooking(t *testing.T) {
+	testenv.RequirePostgres(t)
+	start := tomorrow().Add(10 * time.Hour)
+	id, err := testRepo.AddBooking(context.Background(), Booking{
+		EventID:    "test-event",
+		TimeStart:  start,
+		TimeEnd:    start.Add(time.Hour),
+		GuestEmail: "guest@example.com",
+		Answers:    map[string]any{"company": "Acme"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testPool.Exec(context.Background(), "delete from service.bookings where id = $1", id)
+	})
+
+	var guestName *string
+	var company string
+	err = testPool.QueryRow(context.Background(),
+		"select guest_name, answers->>'company' from service.bookings where id = $1", id).Scan(&guestName, &company)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guestName != nil || company != "Acme" {
+		t.Fatalf("got guest_name %v, company %q", guestName, company)
+	}
+}
+
+func TestAddBookingUser(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	user, err := testRepo.UpsertUser(ctx, UserVisit{Email: "booker@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testPool.Exec(ctx, "delete from service.bookings where guest_email = 'booker@example.com'")
+		testPool.Exec(ctx, "delete from users.users where id = $1", user.ID)
+	})
+
+	start := tomorrow().Add(11 * time.Hour)
+	for _, tt := range []struct{ userID, want string }{
+		{user.ID, user.ID},
+		{"6f1c1a3e-0000-4000-8000-000000000000", ""},
+		{"<nil>", ""},
+		{"", ""},
+	} {
+		id, err := testRepo.AddBooking(ctx, Booking{
+			TimeStart:  start,
+			TimeEnd:    start.Add(time.Hour),
+			GuestEmail: "booker@example.com",
+			UserID:     tt.userID,
+		})
+		if err != nil {
+			t.Fatalf("user id %q: %v", tt.userID, err)
+		}
+		var got string
+		err = testPool.QueryRow(ctx, "select coalesce(user_id::text, '') from service.bookings where id = $1", id).Scan(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("user id %q: stored %q, want %q", tt.userID, got, tt.want)
+		}
+	}
+}
+
+func TestUpsertUser(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	created, err := testRepo.UpsertUser(ctx, UserVisit{Email: "visitor@example.com", Name: "Visitor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testPool.Exec(context.Background(), "delete from users.users where id = $1", created.ID)
+	})
+	if created.ID == "" {
+		t.Fatal("no id for a new user")
+	}
+
+	updated, err := testRepo.UpsertUser(ctx, UserVisit{ID: created.ID, Name: "Renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || updated.Email != "visitor@example.com" || updated.Name != "Renamed" {
+		t.Fatalf("got %+v, want same id and email with new name", updated)
+	}
+}
+
+func TestCreateSlotOverlap(t *testing.T) {
+	testenv.RequirePostgres(t)
+	day := tomorrow()
+	addSlot(t, day, 3*time.Hour+17*time.Minute, 45*time.Minute)
+	weekday := strings.ToLower(day.Weekday().String())
+
+	_, err := testRepo.CreateSlot(context.Background(), TimeSlot{
+		DayOfWeek: weekday,
+		TimeStart: 3*time.Hour + 30*time.Minute,
+		Duration:  time.Hour,
+	})
+	if !errors.Is(err, ErrOverlap) {
+		t.Fatalf("got %v, want ErrOverlap", err)
+	}
+}
+
+func TestBlackoutHidesSlots(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	day := tomorrow()
+	start := addSlot(t, day, 3*time.Hour+17*time.Minute, 45*time.Minute)
+	if err := testRepo.SetBlackout(ctx, Blackout{Date: day, Reason: "holiday"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testRepo.DeleteBlackout(ctx, day) })
+
+	days, err := testRepo.FreeSlots(ctx, day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 0 {
+		t.Fatalf("got %v on a blackout date, want nothing", days)
+	}
+	if _, err := testRepo.TargetSlot(ctx, start); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBookingsFilterAndCancel(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	start := tomorrow().Add(10 * time.Hour)
+	guest := fmt.Sprintf("filter-%d@example.com", time.Now().UnixNano())
+	t.Cleanup(func() {
+		testPool.Exec(ctx, "delete from service.bookings where guest_email = $1", guest)
+	})
+	var ids []string
+	for i := range 3 {
+		id, err := testRepo.AddBooking(ctx, Booking{
+			TimeStart:  start.AddDate(0, 0, i),
+			TimeEnd:    start.AddDate(0, 0, i).Add(time.Hour),
+			GuestEmail: guest,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	calendarDown := errors.New("calendar is down")
+	_, err := testRepo.CancelBooking(ctx, ids[0], "no show", func(b Booking) error {
+		if b.Status != BookingCancelled || b.CancelReason != "no show" {
+			t.Errorf("beforeCommit got %+v, want the cancelled booking", b)
+		}
+		return calendarDown
+	})
+	if !errors.Is(err, calendarDown) {
+		t.Fatalf("failing beforeCommit: got %v, want its error", err)
+	}
+	if b, err := testRepo.Booking(ctx, ids[0]); err != nil || b.Status != BookingConfirmed {
+		t.Fatalf("after a failed cancel: got %+v, %v, want the booking still confirmed", b, err)
+	}
+
+	if _, err := testRepo.CancelBooking(ctx, ids[0], "no show", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testRepo.CancelBooking(ctx, ids[0], "", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("cancelling twice: got %v, want ErrNotFound", err)
+	}
+
+	page, total, err := testRepo.Bookings(ctx, BookingFilter{
+		GuestEmail: strings.ToUpper(guest),
+		Status:     BookingConfirmed,
+		Limit:      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(page) != 1 || page[0].ID != ids[2] {
+		t.Fatalf("got total %d and page %v, want 2 and the latest booking %s", total, page, ids[2])
+	}
+
+	b, err := testRepo.Booking(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Status != BookingCancelled || b.CancelReason != "no show" || b.CancelTime == nil {
+		t.Fatalf("got %+v, want cancelled with a reason", b)
+	}
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrOverlap is returned when a slot overlaps another slot on the same
+	// day of the week (the gist exclusion constraint on meeting_time_slots).
+	ErrOverlap = errors.New("overlaps an existing slot")
+	// ErrExists is returned when a row with the same key already exists.
+	ErrExists = errors.New("already exists")
+)
+
+// Blackout is a date on which no slots are offered.
+type Blackout struct {
+	Date   time.Time
+	Reason string
+}
+
+// schemaError maps constraint violations to the repository errors.
+func schemaError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23P01":
+			return ErrOverlap
+		case "23505":
+			return ErrExists
+		}
+	}
+	return err
+}
+
+// Slots lists the weekly schedule ordered by day and start time. It reads
+// from the primary so admins see their own changes straight away.
+func (r *Repository) Slots(ctx context.Context) ([]TimeSlot, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Pool.Query(ctx, `
+		select id::text, day_of_week::text, time_start, duration
+		  from service.meeting_time_slots
+		 order by day_of_week, time_start`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanTimeSlot)
+}
+
+func (r *Repository) CreateSlot(ctx context.Context, s TimeSlot) (*TimeSlot, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Pool.Query(ctx, `
+		insert into service.meeting_time_slots (day_of_week, time_start, duration)
+		values ($1::service.day_of_week, $2, $3)
+		returning id::text, day_of_week::text, time_start, duration`,
+		s.DayOfWeek, s.TimeStart, s.Duration)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := pgx.CollectExactlyOneRow(rows, scanTimeSlot)
+	if err != nil {
+		return nil, schemaError(err)
+	}
+	return &slot, nil
+}
+
+// UpdateSlot replaces the slot with s.ID; ErrNotFound when there is none.
+func (r *Repository) UpdateSlot(ctx context.Context, s TimeSlot) (*TimeSlot, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Pool.Query(ctx, `
+		update service.meeting_time_slots
+		   set day_of_week = $2::service.day_of_week, time_start = $3, duration = $4
+		 where id = $1
+		returning id::text, day_of_week::text, time_start, duration`,
+		s.ID, s.DayOfWeek, s.TimeStart, s.Duration)
+	if err != nil {
+		return nil, err
+	}
+	slot, err := pgx.CollectExactlyOneRow(rows, scanTimeSlot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, schemaError(err)
+	}
+	return &slot, nil
+}
+
+func (r *Repository) DeleteSlot(ctx context.Context, id string) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Pool.Exec(ctx, "delete from service.meeting_time_slots where id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanTimeSlot(row pgx.CollectableRow) (TimeSlot, error) {
+	var s TimeSlot
+	err := row.Scan(&s.ID, &s.DayOfWeek, &s.TimeStart, &s.Duration)
+	return s, err
+}
+
+// AddAttendee invites a host to every meeting; ErrExists when the email is
+// already invited.
+func (r *Repository) AddAttendee(ctx context.Context, a Attendee) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Pool.Exec(ctx,
+		"insert into service.meeting_attendees (name, email) values ($1, $2)", a.Name, a.Email)
+	return schemaError(err)
+}
+
+// RenameAttendee changes the display name of the attendee with email.
+func (r *Repository) RenameAttendee(ctx context.Context, email, name string) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Pool.Exec(ctx,
+		"update service.meeting_attendees set name = $2 where lower(email) = lower($1)", email, name)
+	if err != nil {
+		return schemaError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repository) DeleteAttendee(ctx context.Context, email string) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Pool.Exec(ctx,
+		"delete from service.meeting_attendees where lower(email) = lower($1)", email)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Blackouts lists blackout dates from from onwards, read from the primary
+// like Slots.
+func (r *Repository) Blackouts(ctx context.Context, from time.Time) ([]Blackout, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.Pool.Query(ctx, `
+		select date, coalesce(reason, '')
+		  from service.blackout_dates
+		 where date >= $1::date
+		 order by date`, from)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Blackout, error) {
+		var b Blackout
+		err := row.Scan(&b.Date, &b.Reason)
+		return b, err
+	})
+}
+
+// SetBlackout adds a blackout date or updates its reason.
+func (r *Repository) SetBlackout(ctx context.Context, b Blackout) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.Pool.Exec(ctx, `
+		insert into service.blackout_dates (date, reason)
+		values ($1::date, $2)
+		on conflict (date) do update set reason = excluded.reason`,
+		b.Date, nullIfEmpty(b.Reason))
+	return err
+}
+
+func (r *Repository) DeleteBlackout(ctx context.Context, date time.Time) error {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	tag, err := r.db.Pool.Exec(ctx, "delete from service.blackout_dates where date = $1::date", date)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserVisit is what the site reports about a visitor on every /user/auth.
+type UserVisit struct {
+	ID          string
+	Email       string
+	Name        string
+	Description string
+	UserAgent   string
+	Country     string
+	IPAddress   string
+}
+
+type User struct {
+	ID    string
+	Email string
+	Name  string
+	Role  string
+}
+
+// UpsertUser creates the user, or updates the visit time and any non-empty
+// fields when visit.ID already exists. An empty ID creates a new user.
+func (r *Repository) UpsertUser(ctx context.Context, visit UserVisit) (*User, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var u User
+	err := r.db.Pool.QueryRow(ctx, `
+		insert into users.users (id, email, user_agent, name, description, country, ip_address)
+		values (coalesce($1::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7)
+		on conflict (id) do update set
+			update_time = now(),
+			last_visited = now(),
+			email = coalesce(excluded.email, users.users.email),
+			user_agent = coalesce(excluded.user_agent, users.users.user_agent),
+			name = coalesce(excluded.name, users.users.name),
+			description = coalesce(excluded.description, users.users.description),
+			country = coalesce(excluded.country, users.users.country),
+			ip_address = coalesce(excluded.ip_address, users.users.ip_address)
+		returning id::text, coalesce(email, ''), coalesce(name, ''), role::text`,
+		nullIfEmpty(visit.ID), nullIfEmpty(visit.Email), nullIfEmpty(visit.UserAgent),
+		nullIfEmpty(visit.Name), nullIfEmpty(visit.Description), nullIfEmpty(visit.Country),
+		nullIfEmpty(visit.IPAddress),
+	).Scan(&u.ID, &u.Email, &u.Name, &u.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// User returns the user with id, or ErrNotFound.
+func (r *Repository) User(ctx context.Context, id string) (*User, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var u User
+	err := r.db.Pool.QueryRow(ctx, `
+		select id::text, coalesce(email, ''), coalesce(name, ''), role::text
+		  from users.users
+		 where id = $1`,
+		id).Scan(&u.ID, &u.Email, &u.Name, &u.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SetUserRole changes the role of the user with id and returns the user, or
+// ErrNotFound. Users are addressed by id only: anyone can claim an email.
+func (r *Repository) SetUserRole(ctx context.Context, id, role string) (*User, error) {
+	ctx, cancel := r.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var u User
+	err := r.db.Pool.QueryRow(ctx, `
+		update users.users
+		   set role = $2::users.user_role, update_time = now()
+		 where id = $1
+		returning id::text, coalesce(email, ''), coalesce(name, ''), role::text`,
+		id, role).Scan(&u.ID, &u.Email, &u.Name, &u.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,211 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of master keys and data keys (AES-256).
+const KeySize = 32
+
+const envelopeVersion = 1
+
+// marker is the only key of a JSON object holding an encrypted value.
+const marker = "$encrypted"
+
+var (
+	ErrNoMasterKey = errors.New("encrypted value found but no master key is configured")
+	ErrUnknownKey  = errors.New("value is encrypted with an unknown master key")
+)
+
+// Envelope is a value encrypted with its own random data key. The data key is
+// stored wrapped by a master key, so rotating the master key only re-wraps the
+// data key and leaves Data untouched. Key and Data hold the nonce followed by
+// the AES-GCM ciphertext.
+type Envelope struct {
+	Version int    `json:"version"`
+	KeyID   string `json:"keyId"`
+	Key     []byte `json:"key"`
+	Data    []byte `json:"data"`
+}
+
+// Keyring holds the primary master key, used for encryption, and previous
+// master keys that are still accepted for decryption.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// KeyID identifies a master key without revealing it.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// GenerateKey returns a new random master key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	for i, key := range append([][]byte{primary}, previous...) {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key must be %d bytes, got %d", KeySize, len(key))
+		}
+		id := KeyID(key)
+		if i == 0 {
+			k.primary = id
+		}
+		k.keys[id] = key
+	}
+	return k, nil
+}
+
+// PrimaryKeyID returns the ID of the key new envelopes are wrapped with.
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Encrypt seals plaintext for the config entry named code. The code is bound
+// as additional data, so an envelope can't be copied to another entry.
+func (k *Keyring) Encrypt(code string, plaintext []byte) (*Envelope, error) {
+	if k == nil {
+		return nil, ErrNoMasterKey
+	}
+	dataKey, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := seal(dataKey, plaintext, []byte(code))
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Version: envelopeVersion,
+		KeyID:   k.primary,
+		Key:     wrapped,
+		Data:    data,
+	}, nil
+}
+
+// Decrypt opens an envelope created by Encrypt for the same code.
+func (k *Keyring) Decrypt(code string, e *Envelope) ([]byte, error) {
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(dataKey, e.Data, []byte(code))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap re-encrypts the data key of e with the primary master key.
+func (k *Keyring) Rewrap(e *Envelope) (*Envelope, error) {
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Version: envelopeVersion,
+		KeyID:   k.primary,
+		Key:     wrapped,
+		Data:    e.Data,
+	}, nil
+}
+
+func (k *Keyring) unwrap(e *Envelope) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoMasterKey
+	}
+	if e.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", e.Version)
+	}
+	masterKey, ok := k.keys[e.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, e.KeyID)
+	}
+	dataKey, err := open(masterKey, e.Key, []byte(e.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// Parse returns the envelope held by a decoded JSON value, if it is one.
+func Parse(value any) (*Envelope, bool) {
+	obj, ok := value.(map[string]any)
+	if !ok || len(obj) != 1 {
+		return nil, false
+	}
+	inner, ok := obj[marker]
+	if !ok {
+		return nil, false
+	}
+	data, err := json.Marshal(inner)
+	if err != nil {
+		return nil, false
+	}
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// Value returns the JSON representation of e as stored in config.config.
+func (e *Envelope) Value() map[string]*Envelope {
+	return map[string]*Envelope{marker: e}
+}
+
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
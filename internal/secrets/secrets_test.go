@@ -0,0 +1,182 @@
+package secrets_test
+
+import (
+	"bytes"
+	"core-regulus-backend/internal/db"
+	"core-regulus-backend/internal/secrets"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeyring(t *testing.T, primary []byte, previous ...[]byte) *secrets.Keyring {
+	t.Helper()
+	k, err := secrets.NewKeyring(primary, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// stored round-trips e through JSON the way config.config keeps it.
+func stored(t *testing.T, e *secrets.Envelope) any {
+	t.Helper()
+	data, err := json.Marshal(e.Value())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := newKeyring(t, newKey(t))
+	plaintext := []byte(`{"client_email":"a@b.c"}`)
+
+	e, err := k.Encrypt("googleCalendar", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(e.Data, plaintext) {
+		t.Fatal("envelope contains the plaintext")
+	}
+	parsed, ok := secrets.Parse(stored(t, e))
+	if !ok {
+		t.Fatal("stored envelope is not recognised")
+	}
+	got, err := k.Decrypt("googleCalendar", parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("got %s, want %s", got, plaintext)
+	}
+}
+
+func TestDecryptUnderAnotherCodeFails(t *testing.T) {
+	k := newKeyring(t, newKey(t))
+	e, err := k.Encrypt("googleCalendar", []byte(`"secret"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Decrypt("googleCalendarId", e); err == nil {
+		t.Fatal("an envelope copied to another code was decrypted")
+	}
+}
+
+func TestUnknownKeyID(t *testing.T) {
+	e, err := newKeyring(t, newKey(t)).Encrypt("code", []byte(`1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newKeyring(t, newKey(t)).Decrypt("code", e)
+	if !errors.Is(err, secrets.ErrUnknownKey) {
+		t.Fatalf("got %v, want ErrUnknownKey", err)
+	}
+
+	var none *secrets.Keyring
+	if _, err := none.Decrypt("code", e); !errors.Is(err, secrets.ErrNoMasterKey) {
+		t.Fatalf("without a keyring: got %v, want ErrNoMasterKey", err)
+	}
+}
+
+func TestTamperedEnvelopeIsRejected(t *testing.T) {
+	k := newKeyring(t, newKey(t))
+	tests := map[string]func(e *secrets.Envelope){
+		"data":    func(e *secrets.Envelope) { e.Data[len(e.Data)-1] ^= 1 },
+		"key":     func(e *secrets.Envelope) { e.Key[len(e.Key)-1] ^= 1 },
+		"nonce":   func(e *secrets.Envelope) { e.Data[0] ^= 1 },
+		"short":   func(e *secrets.Envelope) { e.Data = e.Data[:4] },
+		"version": func(e *secrets.Envelope) { e.Version++ },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := k.Encrypt("code", []byte(`"secret"`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tamper(e)
+			if _, err := k.Decrypt("code", e); err == nil {
+				t.Fatal("tampered envelope was decrypted")
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey, newKeyBytes := newKey(t), newKey(t)
+	old := newKeyring(t, oldKey)
+	e, err := old.Encrypt("code", []byte(`"secret"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newKeyring(t, newKeyBytes, oldKey)
+	if got, err := rotated.Decrypt("code", e); err != nil || string(got) != `"secret"` {
+		t.Fatalf("previous key: got %s, %v", got, err)
+	}
+
+	rewrapped, err := rotated.Rewrap(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyID != rotated.PrimaryKeyID() || rewrapped.KeyID == e.KeyID {
+		t.Fatalf("rewrapped with key %s, want the primary %s", rewrapped.KeyID, rotated.PrimaryKeyID())
+	}
+	if !bytes.Equal(rewrapped.Data, e.Data) {
+		t.Fatal("Rewrap re-encrypted the data")
+	}
+	if got, err := newKeyring(t, newKeyBytes).Decrypt("code", rewrapped); err != nil || string(got) != `"secret"` {
+		t.Fatalf("new key alone: got %s, %v", got, err)
+	}
+	if _, err := old.Decrypt("code", rewrapped); !errors.Is(err, secrets.ErrUnknownKey) {
+		t.Fatalf("old key alone: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestDecryptConfig(t *testing.T) {
+	k := newKeyring(t, newKey(t))
+	e, err := k.Encrypt("googleCalendar", []byte(`{"type":"service_account"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := db.ConfigMap{
+		"googleCalendarId": "calendar@example.com",
+		"limits":           map[string]any{"max": 3.0},
+		"googleCalendar":   stored(t, e),
+	}
+
+	got, err := db.DecryptConfig(raw, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := db.ConfigMap{
+		"googleCalendarId": "calendar@example.com",
+		"limits":           map[string]any{"max": 3.0},
+		"googleCalendar":   map[string]any{"type": "service_account"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	plain := db.ConfigMap{"googleCalendarId": "calendar@example.com"}
+	if got, err := db.DecryptConfig(plain, nil); err != nil || !reflect.DeepEqual(got, plain) {
+		t.Fatalf("plaintext without a keyring: got %v, %v", got, err)
+	}
+	if _, err := db.DecryptConfig(raw, nil); !errors.Is(err, secrets.ErrNoMasterKey) {
+		t.Fatalf("encrypted without a keyring: got %v, want ErrNoMasterKey", err)
+	}
+}
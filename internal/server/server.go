@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"core-regulus-backend/internal/admin"
+	"core-regulus-backend/internal/calendar"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/db"
+	"core-regulus-backend/internal/deadline"
+	"core-regulus-backend/internal/health"
+	"core-regulus-backend/internal/logging"
+	"core-regulus-backend/internal/metrics"
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/repository"
+	"core-regulus-backend/internal/token"
+	"core-regulus-backend/internal/tracing"
+	"core-regulus-backend/internal/user"
+	"fmt"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// Server wires the configuration, the database, the Calendar provider and the
+// HTTP handlers together. Everything a handler needs is passed in explicitly.
+type Server struct {
+	Config   *config.Config
+	DB       *db.DB
+	Repo     *repository.Repository
+	Calendar *calendar.Provider
+	Tokens   *token.Issuer
+	Health   *health.Registry
+	App      *fiber.App
+	// Metrics serves /metrics on its own address so it isn't reachable
+	// through the public API.
+	Metrics *fiber.App
+	Logger  *slog.Logger
+
+	shutdownTracing func(context.Context) error
+}
+
+// New connects to the database and builds the HTTP application. A Calendar
+// client that can't be created is not fatal: calendar endpoints answer 503
+// until it recovers.
+func New(ctx context.Context, cfg *config.Config) (*Server, error) {
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("initialize tracing: %w", err)
+	}
+	s := &Server{
+		Config:          cfg,
+		Tokens:          token.NewIssuer(cfg.JWT),
+		Health:          health.NewRegistry(),
+		Logger:          slog.Default(),
+		shutdownTracing: shutdownTracing,
+	}
+
+	s.DB, err = db.Open(ctx, cfg)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	s.Repo = repository.New(s.DB)
+	s.Calendar = calendar.NewProvider(s.DB, cfg.Google)
+	if err := s.Calendar.Init(ctx); err != nil {
+		s.Logger.Error("calendar is unavailable, calendar endpoints will answer 503 until it recovers", "error", err)
+	}
+	s.DB.WatchConfig()
+
+	s.Health.Register("database", s.DB.Ping)
+	s.Health.Register("config", s.DB.CheckSettings)
+	s.Health.Register("googleCalendar", s.Calendar.CheckCredentials)
+	if cfg.IsLocal() {
+		s.Health.Register("sshTunnel", s.DB.CheckTunnel)
+	}
+
+	s.App = s.newApp()
+	s.Metrics = fiber.New(fiber.Config{DisableStartupMessage: true})
+	metrics.InitRoutes(s.Metrics)
+	return s, nil
+}
+
+func (s *Server) newApp() *fiber.App {
+	cfg := s.Config
+	app := fiber.New(fiber.Config{
+		ErrorHandler: problem.ErrorHandler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	})
+	app.Use(cors.New(cors.Config{
+		AllowOrigins: "https://core-regulus.com, http://localhost:9001",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Traceparent, Tracestate, X-Request-ID",
+		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
+	}))
+	app.Use(tracing.Middleware)
+	app.Use(logging.Middleware)
+	app.Use(metrics.Middleware)
+	app.Use(deadline.Middleware(cfg.Server.RequestTimeout))
+
+	health.InitRoutes(app, s.Health)
+	calendar.InitRoutes(app, calendar.NewHandler(s.Repo, s.Calendar), s.Tokens)
+	user.InitRoutes(app, user.NewHandler(s.Repo, s.Tokens))
+	admin.InitRoutes(app, admin.NewHandler(s.Repo, s.Calendar), s.Tokens)
+	return app
+}
+
+// Run serves HTTP until ctx is cancelled, then waits for in-flight requests
+// for up to the configured shutdown timeout.
+func (s *Server) Run(ctx context.Context) error {
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		timeout := s.Config.Server.ShutdownTimeout
+		s.Logger.Info("shutting down, waiting for in-flight requests", "timeout", timeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := s.App.ShutdownWithContext(shutdownCtx); err != nil {
+			s.Logger.Error("shutdown error", "error", err)
+		}
+		if err := s.Metrics.ShutdownWithContext(shutdownCtx); err != nil {
+			s.Logger.Error("metrics shutdown error", "error", err)
+		}
+	}()
+
+	if addr := s.Config.Server.MetricsAddress; addr != "" {
+		go func() {
+			if err := s.Metrics.Listen(addr); err != nil {
+				s.Logger.Error("metrics listener stopped", "address", addr, "error", err)
+			}
+		}()
+	}
+
+	if err := s.App.Listen(s.Config.Server.Address); err != nil {
+		return err
+	}
+	<-shutdownDone
+	return nil
+}
+
+// Close releases the database and flushes pending spans.
+func (s *Server) Close() {
+	if s.DB != nil {
+		s.DB.Close()
+	}
+	if s.shutdownTracing != nil {
+		if err := s.shutdownTracing(context.Background()); err != nil {
+			s.Logger.Error("tracing shutdown error", "error", err)
+		}
+	}
+}
@@ -0,0 +1,629 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/testenv"
+	"core-regulus-backend/internal/token"
+	"core-regulus-backend/internal/tracing"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// These tests drive the HTTP API end to end against a real Postgres (see
+// testenv.PostgresForTests) and a fake Google Calendar.
+var (
+	testServer *Server
+	testConn   *pgx.Conn
+	fakeGoogle *testenv.FakeCalendar
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	pg := testenv.PostgresForTests(ctx)
+	if pg == nil {
+		os.Exit(m.Run())
+	}
+	fakeGoogle = testenv.NewFakeCalendar()
+
+	code, err := run(ctx, m, pg)
+	if err != nil {
+		fmt.Println(err)
+		code = 1
+	}
+	fakeGoogle.Close()
+	pg.Stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, m *testing.M, pg *testenv.Postgres) (int, error) {
+	var err error
+	testConn, err = pgx.Connect(ctx, pg.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer testConn.Close(ctx)
+
+	account, err := fakeGoogle.ServiceAccountJSON()
+	if err != nil {
+		return 0, err
+	}
+	for code, value := range map[string]any{
+		"googleCalendarId": "calendar@core-regulus.com",
+		"googleCalendar":   json.RawMessage(account),
+	} {
+		data, _ := json.Marshal(value)
+		if _, err := testConn.Exec(ctx, "select config.set($1, $2)", code, data); err != nil {
+			return 0, err
+		}
+	}
+
+	cfg, err := testConfig(pg.URL)
+	if err != nil {
+		return 0, err
+	}
+	testServer, err = New(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer testServer.Close()
+	return m.Run(), nil
+}
+
+func testConfig(url string) (*config.Config, error) {
+	conn, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &config.Config{
+		Environment: "test",
+		Server:      config.ServerConfig{RequestTimeout: 10 * time.Second},
+		Database: config.DatabaseConfig{
+			Host:           conn.Host,
+			Port:           int(conn.Port),
+			Name:           conn.Database,
+			User:           conn.User,
+			Password:       conn.Password,
+			QueryTimeout:   5 * time.Second,
+			SSLMode:        "disable",
+			ConnectTimeout: 10 * time.Second,
+			MaxConns:       4,
+		},
+		Google: config.GoogleConfig{Timeout: 5 * time.Second, Endpoint: fakeGoogle.Endpoint()},
+		JWT:    config.JWTConfig{PrivateKey: key, PublicKey: &key.PublicKey},
+	}, nil
+}
+
+// addDailySlots schedules a one hour slot at 09:00 on every weekday.
+func addDailySlots(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	rows, err := testConn.Query(ctx, `
+		insert into service.meeting_time_slots (day_of_week, time_start, duration)
+		select d, interval '9 hours', interval '1 hour'
+		from unnest(enum_range(null::service.day_of_week)) d
+		on conflict do nothing
+		returning id::text`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testConn.Exec(ctx, "delete from service.meeting_time_slots where id::text = any($1)", ids)
+	})
+}
+
+func day(offset int) time.Time {
+	return time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, offset)
+}
+
+func post(t *testing.T, path string, body any, bearer string) (int, []byte) {
+	t.Helper()
+	return request(t, http.MethodPost, path, body, bearer)
+}
+
+func request(t *testing.T, method, path string, body any, bearer string) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := testServer.App.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+// auth signs in through /user/auth and returns the issued token.
+func auth(t *testing.T, email, bearer string) string {
+	t.Helper()
+	status, body := post(t, "/user/auth", map[string]string{"email": email, "name": "User"}, bearer)
+	if status != http.StatusCreated {
+		t.Fatalf("auth: status %d: %s", status, body)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Token
+}
+
+// userWithRole creates a user, gives them role and returns the token
+// /user/auth issues to them afterwards.
+func userWithRole(t *testing.T, role string) string {
+	t.Helper()
+	email := fmt.Sprintf("%s-%d@example.com", role, time.Now().UnixNano())
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from users.users where email = $1", email)
+	})
+	guest := auth(t, email, "")
+	data, err := testServer.Tokens.ValidateJWT(guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := testServer.Repo.SetUserRole(context.Background(), data.Id, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As the user token command does; /user/auth only issues guest tokens.
+	signed, err := testServer.Tokens.GenerateJWT(token.UserTokenData{Id: user.ID, Email: user.Email, Name: user.Name, Role: user.Role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestCalendarDays(t *testing.T) {
+	testenv.RequirePostgres(t)
+	addDailySlots(t)
+	fakeGoogle.Reset()
+	busyDay, freeDay := day(2), day(3)
+	fakeGoogle.AddBusy(busyDay.Add(9*time.Hour), busyDay.Add(10*time.Hour))
+
+	status, body := post(t, "/calendar/days", map[string]string{
+		"dateStart": busyDay.Format("2006-01-02"),
+		"dateEnd":   freeDay.Format("2006-01-02"),
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var resp struct {
+		Days []struct {
+			Date  string `json:"date"`
+			Slots []struct {
+				TimeStart string `json:"timeStart"`
+			} `json:"slots"`
+		} `json:"days"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	slots := map[string][]string{}
+	for _, d := range resp.Days {
+		for _, s := range d.Slots {
+			slots[d.Date] = append(slots[d.Date], s.TimeStart)
+		}
+	}
+	busy := busyDay.Add(9 * time.Hour).Format("2006-01-02T15:04:05")
+	for _, s := range slots[busyDay.Format("2006-01-02")] {
+		if s == busy {
+			t.Errorf("busy slot %s is offered", busy)
+		}
+	}
+	free := freeDay.Add(9 * time.Hour).Format("2006-01-02T15:04:05")
+	if got := slots[freeDay.Format("2006-01-02")]; len(got) != 1 || got[0] != free {
+		t.Errorf("got slots %v on %s, want [%s]", got, freeDay.Format("2006-01-02"), free)
+	}
+}
+
+func TestCalendarEvent(t *testing.T) {
+	testenv.RequirePostgres(t)
+	addDailySlots(t)
+	fakeGoogle.Reset()
+	start := day(4).Add(9 * time.Hour)
+	guest := "guest-" + start.Format("20060102") + "@example.com"
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from service.bookings where guest_email = $1", guest)
+	})
+	req := map[string]string{
+		"time":       start.Format(time.RFC3339),
+		"guestEmail": guest,
+		"guestName":  "Guest",
+	}
+	userToken := userWithRole(t, "guest")
+	user, err := testServer.Tokens.ValidateJWT(userToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := post(t, "/calendar/event", req, "not-a-token"); status != http.StatusUnauthorized {
+		t.Fatalf("with an invalid token: status %d, want 401", status)
+	}
+	status, body := post(t, "/calendar/event", req, userToken)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	events := fakeGoogle.Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events in the calendar, want 1", len(events))
+	}
+	emails := map[string]bool{}
+	for _, a := range events[0].Attendees {
+		emails[a.Email] = true
+	}
+	if !emails[guest] || !emails["rabinmiller@gmail.com"] {
+		t.Errorf("attendees %v, want the guest and the meeting attendees", emails)
+	}
+
+	var eventID, userID string
+	err = testConn.QueryRow(context.Background(), `
+		select event_id, coalesce(user_id::text, '')
+		  from service.bookings
+		 where guest_email = $1 and time_start = $2`, guest, start).Scan(&eventID, &userID)
+	if err != nil {
+		t.Fatalf("booking is not stored: %v", err)
+	}
+	if eventID != events[0].Id {
+		t.Errorf("booking event_id %q, want %q", eventID, events[0].Id)
+	}
+	if userID != user.Id {
+		t.Errorf("booking user_id %q, want the signed-in user %q", userID, user.Id)
+	}
+
+	if status, body := post(t, "/calendar/event", req, ""); status != http.StatusConflict {
+		t.Fatalf("second booking: status %d, want 409: %s", status, body)
+	}
+}
+
+func TestMeetingType(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	if _, err := testConn.Exec(ctx, "insert into service.meeting_types (code, name) values ('test-form', 'Form')"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testConn.Exec(ctx, "delete from service.meeting_types where code = 'test-form'")
+	})
+	_, err := testConn.Exec(ctx, `
+		insert into service.meeting_questions (meeting_type, code, label, kind, required, options, sort_order)
+		values ('test-form', 'budget', 'Budget', 'select', true, '["small", "large"]', 2),
+		       ('test-form', 'company', 'Company', 'text', false, null, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := request(t, http.MethodGet, "/calendar/meeting-types/test-form", nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var got struct {
+		Code      string `json:"code"`
+		Name      string `json:"name"`
+		Questions []struct {
+			Code     string   `json:"code"`
+			Label    string   `json:"label"`
+			Kind     string   `json:"kind"`
+			Required bool     `json:"required"`
+			Options  []string `json:"options"`
+		} `json:"questions"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != "test-form" || got.Name != "Form" || len(got.Questions) != 2 {
+		t.Fatalf("got %s", body)
+	}
+	company, budget := got.Questions[0], got.Questions[1]
+	if company.Code != "company" || company.Label != "Company" || company.Kind != "text" || company.Required || company.Options != nil {
+		t.Errorf("first question %+v, want the optional company text field", company)
+	}
+	if budget.Code != "budget" || budget.Kind != "select" || !budget.Required || strings.Join(budget.Options, ",") != "small,large" {
+		t.Errorf("second question %+v, want the required budget select", budget)
+	}
+
+	status, body = request(t, http.MethodGet, "/calendar/meeting-types/no-such-type", nil, "")
+	if status != http.StatusNotFound || !strings.Contains(string(body), "meeting_type_not_found") {
+		t.Errorf("unknown type: status %d: %s", status, body)
+	}
+}
+
+func TestUserAuth(t *testing.T) {
+	testenv.RequirePostgres(t)
+	email := fmt.Sprintf("user-%d@example.com", time.Now().UnixNano())
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from users.users where email = $1", email)
+	})
+
+	first, err := testServer.Tokens.ValidateJWT(auth(t, email, ""))
+	if err != nil {
+		t.Fatalf("token doesn't validate: %v", err)
+	}
+	if first.Id == "" || first.Email != email {
+		t.Fatalf("got token data %+v", first)
+	}
+
+	token, _ := testServer.Tokens.GenerateJWT(*first)
+	second, err := testServer.Tokens.ValidateJWT(auth(t, email, token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Id != first.Id {
+		t.Errorf("returning user got id %s, want %s", second.Id, first.Id)
+	}
+}
+
+func TestUserAuthElevatedTokens(t *testing.T) {
+	testenv.RequirePostgres(t)
+	ctx := context.Background()
+	email := fmt.Sprintf("admin-%d@example.com", time.Now().UnixNano())
+	t.Cleanup(func() {
+		testConn.Exec(ctx, "delete from users.users where email = $1", email)
+	})
+	validate := func(signed string) *token.UserTokenData {
+		t.Helper()
+		data, err := testServer.Tokens.ValidateJWT(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	guest := auth(t, email, "")
+	id := validate(guest).Id
+	if _, err := testServer.Repo.SetUserRole(ctx, id, token.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if data := validate(auth(t, email, guest)); data.Role != token.RoleGuest {
+		t.Errorf("/user/auth promoted a guest token to %s", data.Role)
+	}
+
+	// Refreshing an unexpired admin token keeps its expiry.
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	admin, _ := testServer.Tokens.GenerateJWT(token.UserTokenData{
+		Id: id, Email: email, Role: token.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(expiresAt)},
+	})
+	renewed := validate(auth(t, email, admin))
+	if renewed.Id != id || renewed.Role != token.RoleAdmin {
+		t.Fatalf("renewed token %+v, want the admin", renewed)
+	}
+	if renewed.ExpiresAt == nil || !renewed.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("renewed token expires at %v, want %v", renewed.ExpiresAt, expiresAt)
+	}
+
+	// An expired admin token keeps the user, not the role.
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"id":    id,
+		"email": email,
+		"role":  token.RoleAdmin,
+		"exp":   time.Now().Add(-time.Hour).Unix(),
+	}).SignedString(testServer.Config.JWT.PrivateKey)
+	data := validate(auth(t, email, expired))
+	if data.Id != id || data.Role != token.RoleGuest || data.ExpiresAt != nil {
+		t.Errorf("after an expired admin token got %+v, want a guest token for the same user", data)
+	}
+	var users int
+	var role string
+	if err := testConn.QueryRow(ctx, "select count(*), min(role::text) from users.users where email = $1", email).Scan(&users, &role); err != nil {
+		t.Fatal(err)
+	}
+	if users != 1 || role != token.RoleAdmin {
+		t.Errorf("got %d users with role %s, want the one admin", users, role)
+	}
+}
+
+func TestHostCancelBooking(t *testing.T) {
+	testenv.RequirePostgres(t)
+	addDailySlots(t)
+	fakeGoogle.Reset()
+	start := day(5).Add(9 * time.Hour)
+	guest := "cancel-" + start.Format("20060102") + "@example.com"
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from service.bookings where guest_email = $1", guest)
+	})
+	status, body := post(t, "/calendar/event", map[string]string{
+		"time":       start.Format(time.RFC3339),
+		"guestEmail": guest,
+		"guestName":  "Guest",
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("book: status %d: %s", status, body)
+	}
+
+	if status, _ := request(t, http.MethodGet, "/admin/bookings", nil, ""); status != http.StatusUnauthorized {
+		t.Fatalf("without token: status %d, want 401", status)
+	}
+	if status, _ := request(t, http.MethodGet, "/admin/bookings", nil, userWithRole(t, "guest")); status != http.StatusForbidden {
+		t.Fatalf("as a guest: status %d, want 403", status)
+	}
+	hostToken := userWithRole(t, "host")
+	if status, _ := request(t, http.MethodGet, "/admin/slots", nil, hostToken); status != http.StatusForbidden {
+		t.Fatalf("slots as a host: status %d, want 403", status)
+	}
+	if status, body := request(t, http.MethodGet, "/admin/bookings?limit=201", nil, hostToken); status != http.StatusBadRequest {
+		t.Fatalf("limit=201: status %d: %s, want 400", status, body)
+	}
+	status, body = request(t, http.MethodGet, "/admin/bookings?limit=200&guestEmail="+guest, nil, hostToken)
+	if status != http.StatusOK {
+		t.Fatalf("list: status %d: %s", status, body)
+	}
+	var list struct {
+		Bookings []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"bookings"`
+		Total int `json:"total"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.Bookings[0].Status != "confirmed" {
+		t.Fatalf("got %+v, want one confirmed booking", list)
+	}
+
+	id := list.Bookings[0].ID
+	fakeGoogle.FailDeletes(true)
+	status, _ = request(t, http.MethodPost, "/admin/bookings/"+id+"/cancel", map[string]string{"reason": "host is ill"}, hostToken)
+	fakeGoogle.FailDeletes(false)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("cancel while Google is down: status %d, want 503", status)
+	}
+	status, body = request(t, http.MethodGet, "/admin/bookings/"+id, nil, hostToken)
+	if status != http.StatusOK || !strings.Contains(string(body), `"status":"confirmed"`) {
+		t.Fatalf("after a failed cancel: status %d: %s, want the booking still confirmed", status, body)
+	}
+	if n := len(fakeGoogle.Events()); n != 1 {
+		t.Fatalf("%d events in the calendar after a failed cancel, want 1", n)
+	}
+
+	status, body = request(t, http.MethodPost, "/admin/bookings/"+id+"/cancel", map[string]string{"reason": "host is ill"}, hostToken)
+	if status != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", status, body)
+	}
+	if n := len(fakeGoogle.Events()); n != 0 {
+		t.Errorf("%d events left in the calendar, want 0", n)
+	}
+	if status, _ := request(t, http.MethodPost, "/admin/bookings/"+id+"/cancel", nil, hostToken); status != http.StatusConflict {
+		t.Errorf("second cancel: status %d, want 409", status)
+	}
+
+	status, body = request(t, http.MethodGet, "/admin/bookings/export.csv?status=cancelled&guestEmail="+guest, nil, hostToken)
+	if status != http.StatusOK {
+		t.Fatalf("export: status %d: %s", status, body)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(body)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], id+",cancelled,") {
+		t.Errorf("got export %q, want the header and the cancelled booking", body)
+	}
+}
+
+func TestAdminSlots(t *testing.T) {
+	testenv.RequirePostgres(t)
+	adminToken := userWithRole(t, "admin")
+	slot := map[string]any{"dayOfWeek": "sunday", "timeStart": "21:10", "durationMinutes": 30}
+
+	status, body := request(t, http.MethodPost, "/admin/slots", slot, adminToken)
+	if status != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", status, body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from service.meeting_time_slots where id = $1", created.ID)
+	})
+
+	slot["timeStart"] = "21:20"
+	status, body = request(t, http.MethodPost, "/admin/slots", slot, adminToken)
+	if status != http.StatusBadRequest || !strings.Contains(string(body), `"Tag":"overlap"`) {
+		t.Fatalf("overlapping slot: status %d: %s, want an overlap validation error", status, body)
+	}
+
+	if status, body := request(t, http.MethodDelete, "/admin/slots/"+created.ID, nil, adminToken); status != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", status, body)
+	}
+}
+
+func TestMetricsAreInternal(t *testing.T) {
+	testenv.RequirePostgres(t)
+	if status, _ := request(t, http.MethodGet, "/metrics", nil, ""); status != http.StatusNotFound {
+		t.Errorf("public /metrics: status %d, want 404", status)
+	}
+
+	resp, err := testServer.Metrics.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "go_goroutines") {
+		t.Errorf("internal /metrics: status %d: %.200s", resp.StatusCode, body)
+	}
+}
+
+func TestFailedRequestIsTraced(t *testing.T) {
+	testenv.RequirePostgres(t)
+	addDailySlots(t)
+	fakeGoogle.Reset()
+	start := day(6).Add(9 * time.Hour)
+	guest := "traced-" + start.Format("20060102") + "@example.com"
+	t.Cleanup(func() {
+		testConn.Exec(context.Background(), "delete from service.bookings where guest_email = $1", guest)
+	})
+	status, body := post(t, "/calendar/event", map[string]string{
+		"time":       start.Format(time.RFC3339),
+		"guestEmail": guest,
+		"guestName":  "Guest",
+	}, "")
+	if status != http.StatusOK {
+		t.Fatalf("book: status %d: %s", status, body)
+	}
+	var id string
+	if err := testConn.QueryRow(context.Background(), "select id::text from service.bookings where guest_email = $1", guest).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.Setup("test", sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	fakeGoogle.FailDeletes(true)
+	status, _ = request(t, http.MethodPost, "/admin/bookings/"+id+"/cancel", nil, userWithRole(t, "host"))
+	fakeGoogle.FailDeletes(false)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("cancel while Google is down: status %d, want 503", status)
+	}
+
+	var span *tracetest.SpanStub
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "POST /admin/bookings/:id/cancel" {
+			span = &s
+		}
+	}
+	if span == nil {
+		t.Fatalf("no span for the cancel request among %d spans", len(exporter.GetSpans()))
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("span status = %+v, want an error", span.Status)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+		t.Errorf("span events = %+v, want the recorded error", span.Events)
+	}
+}
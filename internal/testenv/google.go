@@ -0,0 +1,199 @@
+package testenv
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// FakeCalendar implements the parts of the Google Calendar REST API the
+// service uses: the OAuth token exchange, freeBusy and listing and inserting
+// events. Every calendar ID shares one set of events.
+type FakeCalendar struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	events      []*calendar.Event
+	failDeletes bool
+}
+
+func NewFakeCalendar() *FakeCalendar {
+	f := &FakeCalendar{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", f.token)
+	mux.HandleFunc("POST /calendar/v3/freeBusy", f.freeBusy)
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendarId}/events", f.listEvents)
+	mux.HandleFunc("POST /calendar/v3/calendars/{calendarId}/events", f.insertEvent)
+	mux.HandleFunc("DELETE /calendar/v3/calendars/{calendarId}/events/{eventId}", f.deleteEvent)
+	f.server = httptest.NewServer(mux)
+	return f
+}
+
+// Endpoint is the Calendar API base URL to configure the client with.
+func (f *FakeCalendar) Endpoint() string {
+	return f.server.URL + "/calendar/v3/"
+}
+
+func (f *FakeCalendar) Close() {
+	f.server.Close()
+}
+
+// ServiceAccountJSON returns a service account key, with a fresh RSA key,
+// whose token_uri points at the fake.
+func (f *FakeCalendar) ServiceAccountJSON() ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "core-regulus-test",
+		"private_key_id": "test",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "calendar@core-regulus-test.iam.gserviceaccount.com",
+		"client_id":      "1",
+		"token_uri":      f.server.URL + "/token",
+	})
+}
+
+// AddBusy puts an event between start and end on the calendar.
+func (f *FakeCalendar) AddBusy(start, end time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, &calendar.Event{
+		Id:      fmt.Sprintf("busy-%d", len(f.events)+1),
+		Summary: "busy",
+		Start:   &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &calendar.EventDateTime{DateTime: end.Format(time.RFC3339)},
+	})
+}
+
+// Events returns the events on the calendar, including inserted ones.
+func (f *FakeCalendar) Events() []*calendar.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*calendar.Event(nil), f.events...)
+}
+
+// FailDeletes makes deleting events fail with 503 until it is called with false.
+func (f *FakeCalendar) FailDeletes(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failDeletes = fail
+}
+
+// Reset removes every event and stops failing deletes.
+func (f *FakeCalendar) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failDeletes = false
+	f.events = nil
+}
+
+func (f *FakeCalendar) overlapping(from, to time.Time) []*calendar.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []*calendar.Event
+	for _, e := range f.events {
+		start, _ := time.Parse(time.RFC3339, e.Start.DateTime)
+		end, _ := time.Parse(time.RFC3339, e.End.DateTime)
+		if start.Before(to) && end.After(from) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (f *FakeCalendar) token(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (f *FakeCalendar) freeBusy(w http.ResponseWriter, r *http.Request) {
+	var req calendar.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, _ := time.Parse(time.RFC3339, req.TimeMin)
+	to, _ := time.Parse(time.RFC3339, req.TimeMax)
+
+	var busy []*calendar.TimePeriod
+	for _, e := range f.overlapping(from, to) {
+		busy = append(busy, &calendar.TimePeriod{Start: e.Start.DateTime, End: e.End.DateTime})
+	}
+	calendars := map[string]calendar.FreeBusyCalendar{}
+	for _, item := range req.Items {
+		calendars[item.Id] = calendar.FreeBusyCalendar{Busy: busy}
+	}
+	writeJSON(w, calendar.FreeBusyResponse{
+		Kind:      "calendar#freeBusy",
+		TimeMin:   req.TimeMin,
+		TimeMax:   req.TimeMax,
+		Calendars: calendars,
+	})
+}
+
+func (f *FakeCalendar) listEvents(w http.ResponseWriter, r *http.Request) {
+	from, _ := time.Parse(time.RFC3339, r.URL.Query().Get("timeMin"))
+	to, _ := time.Parse(time.RFC3339, r.URL.Query().Get("timeMax"))
+	writeJSON(w, calendar.Events{
+		Kind:  "calendar#events",
+		Items: f.overlapping(from, to),
+	})
+}
+
+func (f *FakeCalendar) insertEvent(w http.ResponseWriter, r *http.Request) {
+	var event calendar.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	event.Id = fmt.Sprintf("event-%d", len(f.events)+1)
+	event.HtmlLink = "https://calendar.example.com/" + event.Id
+	if event.ConferenceData != nil {
+		event.HangoutLink = "https://meet.example.com/" + event.Id
+	}
+	f.events = append(f.events, &event)
+	f.mu.Unlock()
+	writeJSON(w, &event)
+}
+
+func (f *FakeCalendar) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failDeletes {
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	for i, e := range f.events {
+		if e.Id == r.PathValue("eventId") {
+			f.events = append(f.events[:i], f.events[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "not found", http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,221 @@
+// Package testenv provides an ephemeral Postgres with the sql/ schema applied
+// and a fake Google Calendar API, so the service can be tested offline.
+package testenv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/jackc/pgx/v5"
+)
+
+// schemaFiles are applied in dependency order.
+var schemaFiles = []string{"shared.sql", "service.sql", "config.sql", "users.sql"}
+
+// Postgres is a scratch database with the schema applied, created for one
+// test binary and dropped by Stop. When TEST_DATABASE_URL is set the database
+// is created on that server, which is otherwise left alone; if not, an
+// embedded server is started in a temporary directory.
+//
+// The embedded server uses the binaries in TEST_POSTGRES_BINARIES (a directory
+// containing bin/pg_ctl), or a local installation found on PATH or under
+// /usr/lib/postgresql. Only without one are binaries downloaded; the archive is
+// cached in ~/.embedded-postgres-go, so later runs work offline.
+type Postgres struct {
+	URL string
+
+	adminURL string
+	name     string
+	embedded *embeddedpostgres.EmbeddedPostgres
+	dir      string
+}
+
+func StartPostgres(ctx context.Context) (*Postgres, error) {
+	p := &Postgres{adminURL: os.Getenv("TEST_DATABASE_URL")}
+	if p.adminURL == "" {
+		if err := p.startEmbedded(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.createDatabase(ctx); err != nil {
+		p.Stop()
+		return nil, err
+	}
+	if err := p.applySchema(ctx); err != nil {
+		p.Stop()
+		return nil, err
+	}
+	return p, nil
+}
+
+// skipReason is set by PostgresForTests when Postgres is unavailable and the
+// developer opted out of the integration tests.
+var skipReason string
+
+// PostgresForTests is StartPostgres for TestMain. If no database can be
+// started the test binary fails, unless TEST_SKIP_POSTGRES is set: then it
+// returns nil and every test calling RequirePostgres is reported as skipped.
+func PostgresForTests(ctx context.Context) *Postgres {
+	p, err := StartPostgres(ctx)
+	if err == nil {
+		return p
+	}
+	if os.Getenv("TEST_SKIP_POSTGRES") == "" {
+		fmt.Fprintf(os.Stderr, "testenv: %v\nSet TEST_POSTGRES_BINARIES or TEST_DATABASE_URL, or TEST_SKIP_POSTGRES=1 to skip the database tests.\n", err)
+		os.Exit(1)
+	}
+	skipReason = "Postgres is unavailable: " + err.Error()
+	return nil
+}
+
+// RequirePostgres skips t when PostgresForTests could not start a database.
+func RequirePostgres(t testing.TB) {
+	t.Helper()
+	if skipReason != "" {
+		t.Skip(skipReason)
+	}
+}
+
+// Stop drops the scratch database and shuts the embedded server down.
+func (p *Postgres) Stop() error {
+	var err error
+	if p.name != "" {
+		err = p.dropDatabase(context.Background())
+	}
+	if p.embedded != nil {
+		err = errors.Join(err, p.embedded.Stop())
+		os.RemoveAll(p.dir)
+	}
+	return err
+}
+
+func (p *Postgres) startEmbedded() error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	p.dir, err = os.MkdirTemp("", "core-regulus-pg-")
+	if err != nil {
+		return err
+	}
+	cfg := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V15).
+		Port(uint32(port)).
+		RuntimePath(filepath.Join(p.dir, "runtime")).
+		DataPath(filepath.Join(p.dir, "data")).
+		Logger(io.Discard)
+	if bin := localBinaries(); bin != "" {
+		cfg = cfg.BinariesPath(bin)
+	}
+	p.adminURL = cfg.GetConnectionURL() + "?sslmode=disable"
+	p.embedded = embeddedpostgres.NewDatabase(cfg)
+	if err := p.embedded.Start(); err != nil {
+		p.embedded = nil
+		os.RemoveAll(p.dir)
+		return fmt.Errorf("start embedded postgres: %w", err)
+	}
+	return nil
+}
+
+// localBinaries returns the directory holding bin/pg_ctl of a local Postgres
+// installation, or "" when there is none.
+func localBinaries() string {
+	if dir := os.Getenv("TEST_POSTGRES_BINARIES"); dir != "" {
+		return dir
+	}
+	if path, err := exec.LookPath("pg_ctl"); err == nil {
+		if path, err = filepath.EvalSymlinks(path); err == nil {
+			return filepath.Dir(filepath.Dir(path))
+		}
+	}
+	matches, _ := filepath.Glob("/usr/lib/postgresql/*/bin/pg_ctl")
+	if len(matches) > 0 {
+		return filepath.Dir(filepath.Dir(matches[len(matches)-1]))
+	}
+	return ""
+}
+
+// createDatabase creates a randomly named database on the server and points
+// URL at it, pinned to UTC so schedule tests are deterministic.
+func (p *Postgres) createDatabase(ctx context.Context) error {
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	name := "core_regulus_test_" + hex.EncodeToString(suffix)
+
+	conn, err := pgx.Connect(ctx, p.adminURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	ident := pgx.Identifier{name}.Sanitize()
+	if _, err := conn.Exec(ctx, "create database "+ident); err != nil {
+		return fmt.Errorf("create test database: %w", err)
+	}
+	p.name = name
+	if _, err := conn.Exec(ctx, "alter database "+ident+" set timezone to 'UTC'"); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(p.adminURL)
+	if err != nil {
+		return err
+	}
+	u.Path = "/" + name
+	p.URL = u.String()
+	return nil
+}
+
+func (p *Postgres) dropDatabase(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, p.adminURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, "drop database if exists "+pgx.Identifier{p.name}.Sanitize()+" with (force)")
+	return err
+}
+
+func (p *Postgres) applySchema(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, p.URL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	for _, name := range schemaFiles {
+		sql, err := os.ReadFile(filepath.Join(sqlDir(), name))
+		if err != nil {
+			return err
+		}
+		if _, err := conn.PgConn().Exec(ctx, string(sql)).ReadAll(); err != nil {
+			return fmt.Errorf("apply %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func sqlDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "sql")
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
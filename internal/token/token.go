@@ -2,50 +2,147 @@ package token
 
 import (
 	"core-regulus-backend/internal/config"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	RoleGuest = "guest"
+	RoleHost  = "host"
+	RoleAdmin = "admin"
+)
+
+// roleRank orders the roles: each one may do everything the ones below can.
+var roleRank = map[string]int{RoleGuest: 0, RoleHost: 1, RoleAdmin: 2}
+
+// elevatedTokenTTL bounds tokens of hosts and admins. /user/auth never extends
+// them: once expired, a new one has to be issued with the user token command.
+// Guest tokens don't expire.
+const elevatedTokenTTL = 12 * time.Hour
+
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
 type UserTokenData struct {
 	Name  string `json:"name"`
 	Id    string `json:"id"`
 	Email string `json:"email"`
+	Role  string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(data UserTokenData) (string, error) {		
-	cfg := config.Get()
+// HasRole reports whether the token grants role or a higher one. Expired
+// data, as IdentifyJWT returns, grants nothing.
+func (d UserTokenData) HasRole(role string) bool {
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	required, ok := roleRank[role]
+	return ok && ValidRole(d.Role) && roleRank[d.Role] >= required
+}
+
+type Issuer struct {
+	cfg config.JWTConfig
+}
+
+func NewIssuer(cfg config.JWTConfig) *Issuer {
+	return &Issuer{cfg: cfg}
+}
+
+// GenerateJWT signs a token for data. Host and admin tokens expire at
+// data.ExpiresAt if set, but no later than elevatedTokenTTL from now.
+func (i *Issuer) GenerateJWT(data UserTokenData) (string, error) {
+	if data.Role == "" {
+		data.Role = RoleGuest
+	}
+	now := time.Now()
+	expiresAt := data.ExpiresAt
 	data.RegisteredClaims = jwt.RegisteredClaims{
 		Issuer:    "core-regulus",
 		Subject:   "user-token",
 		ExpiresAt: nil,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-	}	
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	if data.Role != RoleGuest {
+		limit := now.Add(elevatedTokenTTL)
+		if expiresAt == nil || expiresAt.After(limit) {
+			expiresAt = jwt.NewNumericDate(limit)
+		}
+		data.ExpiresAt = expiresAt
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, data)
-	return token.SignedString(cfg.JWT.PrivateKey)
+	return token.SignedString(i.cfg.PrivateKey)
+}
+
+func (i *Issuer) ValidateJWT(tokenString string) (*UserTokenData, error) {
+	return i.parse(tokenString)
+}
+
+// IdentifyJWT is ValidateJWT that also accepts expired tokens. It only tells
+// who the user is, for /user/auth to keep their id; the role of an expired
+// token must not be trusted, see Renew.
+func (i *Issuer) IdentifyJWT(tokenString string) (*UserTokenData, error) {
+	data, err := i.parse(tokenString)
+	if !errors.Is(err, jwt.ErrTokenExpired) {
+		return data, err
+	}
+	return i.parse(tokenString, jwt.WithoutClaimsValidation())
 }
 
-func ValidateJWT(tokenString string) (*UserTokenData, error) {	
-	cfg := config.Get()
+// Renew returns the data for the token /user/auth issues to user, who is
+// stored with user.Role, given the token the request came with, if any. A
+// host or admin role is kept only while presented is an unexpired token with
+// that role, and only until it expires, so renewing can't extend it; the role
+// drops if the stored one is lower. Everyone else gets a guest token.
+func Renew(presented *UserTokenData, user UserTokenData) UserTokenData {
+	stored := user.Role
+	user.Role = RoleGuest
+	user.RegisteredClaims = jwt.RegisteredClaims{}
+	if presented == nil || presented.ExpiresAt == nil || !presented.ExpiresAt.After(time.Now()) {
+		return user
+	}
+	role := presented.Role
+	if !ValidRole(stored) || roleRank[stored] < roleRank[role] {
+		role = stored
+	}
+	if ValidRole(role) && role != RoleGuest {
+		user.Role = role
+		user.ExpiresAt = presented.ExpiresAt
+	}
+	return user
+}
+
+func (i *Issuer) parse(tokenString string, opts ...jwt.ParserOption) (*UserTokenData, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return cfg.JWT.PublicKey, nil
-	})
+		return i.cfg.PublicKey, nil
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return &UserTokenData{
-			Id: fmt.Sprintf("%v", claims["id"]),
-			Email:   fmt.Sprintf("%v", claims["email"]),
-			Name:   fmt.Sprintf("%v", claims["name"]),
-		}, nil
+		// Tokens issued before roles existed carry none.
+		role, _ := claims["role"].(string)
+		if !ValidRole(role) {
+			role = RoleGuest
+		}
+		data := &UserTokenData{
+			Id:    fmt.Sprintf("%v", claims["id"]),
+			Email: fmt.Sprintf("%v", claims["email"]),
+			Name:  fmt.Sprintf("%v", claims["name"]),
+			Role:  role,
+		}
+		data.ExpiresAt, _ = claims.GetExpirationTime()
+		return data, nil
 	} else {
 		return nil, fmt.Errorf("invalid token")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,87 @@
+package token
+
+import (
+	"core-regulus-backend/internal/config"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func sameTime(a, b *jwt.NumericDate) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(b.Time)
+}
+
+func TestRenew(t *testing.T) {
+	soon := jwt.NewNumericDate(time.Now().Add(time.Hour).Truncate(time.Second))
+	past := jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	token := func(role string, expiresAt *jwt.NumericDate) *UserTokenData {
+		return &UserTokenData{Id: "u1", Role: role, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: expiresAt}}
+	}
+
+	tests := []struct {
+		name      string
+		presented *UserTokenData
+		stored    string
+		role      string
+		expiresAt *jwt.NumericDate
+	}{
+		{"anonymous", nil, RoleAdmin, RoleGuest, nil},
+		{"guest", token(RoleGuest, nil), RoleGuest, RoleGuest, nil},
+		{"promoted guest", token(RoleGuest, nil), RoleAdmin, RoleGuest, nil},
+		{"admin keeps expiry", token(RoleAdmin, soon), RoleAdmin, RoleAdmin, soon},
+		{"demoted admin", token(RoleAdmin, soon), RoleHost, RoleHost, soon},
+		{"removed admin", token(RoleAdmin, soon), RoleGuest, RoleGuest, nil},
+		{"promoted host", token(RoleHost, soon), RoleAdmin, RoleHost, soon},
+		{"expired admin", token(RoleAdmin, past), RoleAdmin, RoleGuest, nil},
+	}
+	for _, tt := range tests {
+		got := Renew(tt.presented, UserTokenData{Id: "u1", Role: tt.stored})
+		if got.Role != tt.role || !sameTime(got.ExpiresAt, tt.expiresAt) {
+			t.Errorf("%s: got role %s expiring %v, want %s expiring %v", tt.name, got.Role, got.ExpiresAt, tt.role, tt.expiresAt)
+		}
+	}
+}
+
+func TestGenerateJWTKeepsEarlierExpiry(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := NewIssuer(config.JWTConfig{PrivateKey: key, PublicKey: &key.PublicKey})
+
+	soon := time.Now().Add(time.Hour).Truncate(time.Second)
+	late := time.Now().Add(30 * 24 * time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *jwt.NumericDate
+		want      time.Time
+	}{
+		{"fresh", nil, time.Now().Add(elevatedTokenTTL)},
+		{"renewed", jwt.NewNumericDate(soon), soon},
+		{"beyond the limit", jwt.NewNumericDate(late), time.Now().Add(elevatedTokenTTL)},
+	}
+	for _, tt := range tests {
+		signed, err := tokens.GenerateJWT(UserTokenData{Id: "u1", Role: RoleAdmin, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: tt.expiresAt}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := tokens.ValidateJWT(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Role != RoleAdmin || data.ExpiresAt == nil || data.ExpiresAt.Sub(tt.want).Abs() > 2*time.Second {
+			t.Errorf("%s: got %s expiring %v, want admin expiring %v", tt.name, data.Role, data.ExpiresAt, tt.want)
+		}
+	}
+
+	guest, _ := tokens.GenerateJWT(UserTokenData{Id: "u2"})
+	if data, err := tokens.ValidateJWT(guest); err != nil || data.ExpiresAt != nil {
+		t.Errorf("guest token: %+v, %v, want one without expiry", data, err)
+	}
+}
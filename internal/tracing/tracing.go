@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"core-regulus-backend/internal/config"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "core-regulus-backend"
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup installs a global tracer provider built from opts together with W3C
+// trace context propagation. Tests can pass sdktrace.WithSyncer with a
+// tracetest.InMemoryExporter to inspect the recorded spans.
+func Setup(serviceName string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	res := resource.NewSchemaless(attribute.String("service.name", serviceName))
+	opts = append([]sdktrace.TracerProviderOption{sdktrace.WithResource(res)}, opts...)
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp
+}
+
+// Init configures tracing from the environment. Without an OTLP endpoint spans
+// are still created and propagated but not exported.
+func Init(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	if cfg.Endpoint != "" {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tp := Setup(cfg.ServiceName, opts...)
+	return tp.Shutdown, nil
+}
+
+type requestCarrier struct {
+	c *fiber.Ctx
+}
+
+func (r requestCarrier) Get(key string) string {
+	return r.c.Get(key)
+}
+
+func (r requestCarrier) Set(key string, value string) {
+	r.c.Request().Header.Set(key, value)
+}
+
+func (r requestCarrier) Keys() []string {
+	headers := r.c.GetReqHeaders()
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Middleware starts a server span for every request, continuing an incoming
+// traceparent, and stores the span context as the request's user context.
+func Middleware(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), requestCarrier{c})
+	ctx, span := Tracer().Start(ctx, c.Method()+" "+c.Path(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Method()),
+			attribute.String("url.path", c.Path()),
+		),
+	)
+	defer span.End()
+
+	c.SetUserContext(ctx)
+	err := c.Next()
+
+	route := c.Route().Path
+	status := c.Response().StatusCode()
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(
+		attribute.String("http.route", route),
+		attribute.Int("http.response.status_code", status),
+	)
+	if err != nil {
+		span.RecordError(err)
+	}
+	if err != nil || status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(status))
+	}
+	return err
+}
+
+// Transport wraps base so outgoing requests get client spans and a traceparent header.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID  = "00f067aa0ba902b7"
+)
+
+func setup(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := Setup("test", sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return exporter
+}
+
+// app serves a route that runs a query through QueryTracer, the way pgx does
+// for every pool connection.
+func app() *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Get("/items/:id", func(c *fiber.Ctx) error {
+		var tracer QueryTracer
+		ctx := tracer.TraceQueryStart(c.UserContext(), nil, pgx.TraceQueryStartData{SQL: "select 1"})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.Get("/broken", func(c *fiber.Ctx) error {
+		var tracer QueryTracer
+		ctx := tracer.TraceQueryStart(c.UserContext(), nil, pgx.TraceQueryStartData{SQL: "select broken"})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("syntax error")})
+		return fiber.ErrInternalServerError
+	})
+	return app
+}
+
+func spans(t *testing.T, exporter *tracetest.InMemoryExporter) (server, query tracetest.SpanStub) {
+	t.Helper()
+	got := exporter.GetSpans()
+	if len(got) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(got))
+	}
+	for _, s := range got {
+		switch s.SpanKind {
+		case trace.SpanKindServer:
+			server = s
+		case trace.SpanKindClient:
+			query = s
+		}
+	}
+	if !server.SpanContext.IsValid() || !query.SpanContext.IsValid() {
+		t.Fatalf("want a server and a client span, got %+v", got)
+	}
+	return server, query
+}
+
+func TestHandlerAndQuerySpans(t *testing.T) {
+	exporter := setup(t)
+
+	resp, err := app().Test(httptest.NewRequest("GET", "/items/42", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	server, query := spans(t, exporter)
+	if server.Name != "GET /items/:id" {
+		t.Errorf("server span name = %q, want the route", server.Name)
+	}
+	if server.Parent.IsValid() {
+		t.Errorf("server span has parent %s without a traceparent", server.Parent.SpanID())
+	}
+	if query.Name != "postgres query" {
+		t.Errorf("query span name = %q", query.Name)
+	}
+	if query.Parent.SpanID() != server.SpanContext.SpanID() || query.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("query span is not a child of the handler span")
+	}
+}
+
+func TestIncomingTraceparent(t *testing.T) {
+	exporter := setup(t)
+
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-"+parentSpanID+"-01")
+	resp, err := app().Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	server, query := spans(t, exporter)
+	if got := server.SpanContext.TraceID().String(); got != parentTraceID {
+		t.Errorf("trace id = %s, want %s", got, parentTraceID)
+	}
+	if got := server.Parent.SpanID().String(); got != parentSpanID {
+		t.Errorf("server span parent = %s, want %s", got, parentSpanID)
+	}
+	if !server.Parent.IsRemote() {
+		t.Error("server span parent should be remote")
+	}
+	if got := query.SpanContext.TraceID().String(); got != parentTraceID {
+		t.Errorf("query trace id = %s, want %s", got, parentTraceID)
+	}
+}
+
+func TestErrorsMarkSpans(t *testing.T) {
+	exporter := setup(t)
+
+	resp, err := app().Test(httptest.NewRequest("GET", "/broken", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	server, query := spans(t, exporter)
+	if server.Status.Code != codes.Error {
+		t.Errorf("server span status = %v, want error", server.Status.Code)
+	}
+	if query.Status.Code != codes.Error || query.Status.Description != "syntax error" {
+		t.Errorf("query span status = %+v, want the query error", query.Status)
+	}
+}
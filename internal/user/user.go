@@ -1,79 +1,42 @@
 package user
 
 import (
-	"context"
-	"core-regulus-backend/internal/db"
+	"core-regulus-backend/internal/auth"
+	"core-regulus-backend/internal/problem"
+	"core-regulus-backend/internal/repository"
 	"core-regulus-backend/internal/token"
-	"fmt"
-	"strings"
+	"core-regulus-backend/internal/validation"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
 
 type InAuthRequest struct {
-	Name        string `json:"name"`
-	Email       string `json:"email"`
-	Description string `json:"description"`
+	Name        string `json:"name" validate:"max=200"`
+	Email       string `json:"email" validate:"omitempty,email,max=254"`
+	Description string `json:"description" validate:"max=4000"`
 	Agent       string `json:"userAgent"`
 	Id          string `json:"id"`
 	Country     string `json:"country,omitempty"`
 	IpAddress   string `json:"ip_address,omitempty"`
 }
 
-func validateUser(user InAuthRequest) error {
-	validate := validator.New()
-	return validate.Struct(user)
+type Handler struct {
+	repo   *repository.Repository
+	tokens *token.Issuer
 }
 
-type ErrorResponse struct {
-	Error       bool
-	FailedField string
-	Value       any
-	Tag         string
-}
-
-func removePrefix(data string, prefix string) string {
-	if after, ok := strings.CutPrefix(data, prefix); ok {
-		return after
-	}
-	if after, ok := strings.CutPrefix(data, strings.ToLower(prefix)); ok {
-		return after
-	}
-
-	return ""
-}
-
-func getBearerTokenString(c *fiber.Ctx) (string, error) {
-	authHeader := c.Get("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("missing Authorization header")
-	}
-
-	val := removePrefix(authHeader, "Bearer ")
-
-	if val == "" {
-		return "", fmt.Errorf("invalid Authorization header format")
-	}
-
-	return val, nil
-}
-
-func getBearerToken(c *fiber.Ctx) (*token.UserTokenData, error) {
-	tokenString, err := getBearerTokenString(c)
-	if err != nil {
-		return nil, err
+func NewHandler(repo *repository.Repository, tokens *token.Issuer) *Handler {
+	return &Handler{
+		repo:   repo,
+		tokens: tokens,
 	}
-	return token.ValidateJWT(tokenString)
 }
 
-func postUserAuthHandler(c *fiber.Ctx) error {
+func (h *Handler) postUserAuthHandler(c *fiber.Ctx) error {
 	var authReq InAuthRequest
 
 	if err := c.BodyParser(&authReq); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse JSON",
-		})
+		return problem.ErrInvalidBody.Wrap(err)
 	}
 
 	headers := c.GetReqHeaders()
@@ -89,43 +52,44 @@ func postUserAuthHandler(c *fiber.Ctx) error {
 	if ok {
 		authReq.IpAddress = ip[0]
 	}
-	if errs := validateUser(authReq); errs != nil {
-		validationErrors := []ErrorResponse{}
-		for _, err := range errs.(validator.ValidationErrors) {
-			var elem ErrorResponse
-			elem.FailedField = err.Field()
-			elem.Value = err.Value()
-			elem.Error = true
-			elem.Tag = err.Tag()
-			validationErrors = append(validationErrors, elem)
-		}
-		return c.Status(fiber.StatusBadRequest).JSON(validationErrors)
+	if validationErrors := validation.Struct(authReq); len(validationErrors) > 0 {
+		return problem.Validation(validationErrors)
 	}
 
-	tokenData, _ := getBearerToken(c)
-	if tokenData != nil {
-		authReq.Id = tokenData.Id
+	// A returning visitor keeps their id, even with an expired host or admin
+	// token; token.Renew decides which role the new token carries.
+	presented := auth.User(c)
+	if presented != nil {
+		authReq.Id = presented.Id
 	} else {
 		authReq.Id = ""
 	}
 
-	pool := db.Connect()
-	ctx := context.Background()
-	var user token.UserTokenData
-	err := pool.QueryRow(ctx, "select users.set_user($1)", authReq).Scan(&user)
+	user, err := h.repo.UpsertUser(c.UserContext(), repository.UserVisit{
+		ID:          authReq.Id,
+		Email:       authReq.Email,
+		Name:        authReq.Name,
+		Description: authReq.Description,
+		UserAgent:   authReq.Agent,
+		Country:     authReq.Country,
+		IPAddress:   authReq.IpAddress,
+	})
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err})
+		return problem.ErrInternal.WithDetail("Cannot store user").Wrap(err)
 	}
 
-	tokenString, err := token.GenerateJWT(user)
+	tokenString, err := h.tokens.GenerateJWT(token.Renew(presented, token.UserTokenData{
+		Id:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Role:  user.Role,
+	}))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Cannot create jwt token",
-		})
+		return problem.ErrInternal.WithDetail("Cannot create jwt token").Wrap(err)
 	}
 	return c.Status(201).JSON(fiber.Map{"status": "OK", "token": tokenString})
 }
 
-func InitRoutes(app *fiber.App) {
-	app.Post("/user/auth", postUserAuthHandler)
+func InitRoutes(app *fiber.App, h *Handler) {
+	app.Post("/user/auth", auth.New(h.tokens, auth.Identify), h.postUserAuthHandler)
 }
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type ErrorResponse struct {
+	Error       bool
+	FailedField string
+	Value       any
+	Tag         string
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+func FieldError(field string, value any, tag string) ErrorResponse {
+	return ErrorResponse{
+		Error:       true,
+		FailedField: field,
+		Value:       value,
+		Tag:         tag,
+	}
+}
+
+func toErrorResponses(err error) []ErrorResponse {
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []ErrorResponse{FieldError("", nil, err.Error())}
+	}
+	result := make([]ErrorResponse, 0, len(errs))
+	for _, e := range errs {
+		result = append(result, FieldError(e.Field(), e.Value(), e.Tag()))
+	}
+	return result
+}
+
+// Struct validates s by its `validate` tags; failed fields are reported by their json names.
+func Struct(s any) []ErrorResponse {
+	return toErrorResponses(validate.Struct(s))
+}
+
+// Var validates a single value against tag and reports failures under field.
+// A malformed tag is reported as a failed "rules" check instead of panicking,
+// since tags may come from stored configuration.
+func Var(field string, value any, tag string) (errs []ErrorResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			errs = []ErrorResponse{FieldError(field, value, "rules")}
+		}
+	}()
+	errs = toErrorResponses(validate.Var(value, tag))
+	for i := range errs {
+		errs[i].FailedField = field
+	}
+	return errs
+}
+
+// Rules reports whether tag can be used to validate values like sample. Rules
+// kept in configuration are checked with it when they are loaded, so a typo
+// surfaces as a configuration error rather than as a rejected answer.
+func Rules(tag string, sample any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid rules %q: %v", tag, r)
+		}
+	}()
+	validate.Var(sample, tag)
+	return nil
+}
@@ -1,25 +1,34 @@
 package main
 
 import (
-	"core-regulus-backend/internal/calendar"
-	"core-regulus-backend/internal/db"
-	"core-regulus-backend/internal/user"
-	"log"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"context"
+	"core-regulus-backend/internal/config"
+	"core-regulus-backend/internal/logging"
+	"core-regulus-backend/internal/server"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	app := fiber.New()
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "https://core-regulus.com, http://localhost:9001",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "POST, OPTIONS",
-	}))
-	db.Connect()
-	calendar.InitRoutes(app)
-	user.InitRoutes(app)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	cfg := config.MustLoad()
+	logging.Setup(cfg.Log.Level, cfg.Log.Format)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv, err := server.New(ctx, cfg)
+	if err != nil {
+		logging.Fatal("can't start server", "error", err)
+	}
+	defer srv.Close()
 
-	log.Fatal(app.Listen(":5000"))
+	if err := srv.Run(ctx); err != nil {
+		srv.Close()
+		logging.Fatal("server error", "error", err)
+	}
 }
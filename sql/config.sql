@@ -5,17 +5,15 @@ create table config.config (
 	value jsonb not null
 );
 
-CREATE OR REPLACE FUNCTION config.get()
- RETURNS jsonb
+CREATE OR REPLACE FUNCTION config.set(config_code text, config_value jsonb)
+ RETURNS void
  LANGUAGE plpgsql
 AS $function$
-declare
-	res jsonb;
-begin  
-	select jsonb_object_agg(code, value) 
-	from config.config
-	into res;
-	return res;
+begin
+	insert into config.config (code, value)
+	values (config_code, config_value)
+	on conflict (code) do update
+		set value = excluded.value;
 end;
 $function$;
 
@@ -36,94 +34,30 @@ $function$
 ;
 
 
-CREATE OR REPLACE FUNCTION service.get_free_slots(date_from timestamp with time zone, date_to timestamp with time zone)
- RETURNS json
- LANGUAGE plpgsql
-AS $function$
-declare
-	res json;
-begin  
-		with days as (
-			select * from service.get_days(date_from, date_to)
-		),
-		slots as (
-			select 
-	    	d.date,
-		    s.time_start,
-	  	  (d.date + s.time_start) as slot_start,
-		    (d.date + s.time_start + s.duration) as slot_end
-	  	from days d
-		  join service.meeting_time_slots s
-	  	  on d.day_of_week = s.day_of_week
-		)
-		select json_agg(json_build_object(
-			'date', date,
-			'slots', slots
-		)) from (
-			select date, 
-				json_agg(
-					json_build_object(
-						'timeStart', slot_start, 
-						'timeEnd', slot_end
-					)
-				order by slot_start
-			) as slots
-		from slots
-		where slot_start > now()
-		group by date
-	)
-	into res;
-	return coalesce(res, '[]'::json);
-end;
-$function$
-;
-
-CREATE OR REPLACE FUNCTION service.get_target_slot(date_from timestamp with time zone)
- RETURNS json
- LANGUAGE plpgsql
-AS $function$
-declare
-	l_res json;
-begin  
-	select json_build_object(
-					'id', id, 
-					'dayOfWeek', day_of_week,
-					'timeStart', time_start, 
-					'duration', extract(epoch from duration)::int,
-					'attendees', ma.attendees
-				 )
-	from service.meeting_time_slots mts
-	into l_res
-	inner join (
-		select json_agg(json_build_object('name', name, 'email', email)) as attendees
-		from service.meeting_attendees
-	) ma on true
-	where day_of_week = lower(trim(to_char(date_from, 'FMDay')))::service.day_of_week and
-				(date_from::time)::interval = mts.time_start and
-				date_from > now()
-	limit 1;
-	return l_res;
-end;
-$function$;
- 
-
-select * from config.config;
-
-insert into config.config (code, value)
-values ('googleCalendarAttendee', '[{ "name": "Vladimir Aseev", email}]')
-
-create table service.meeting_attendee (
+create table service.meeting_attendees (
 	name text,
 	email text,
 	primary key (name, email)
 );
 
-insert into service.meeting_attendee (name, email)
+create unique index meeting_attendees_email on service.meeting_attendees (lower(email));
+
+insert into service.meeting_attendees (name, email)
 values ('Vladimir Aseev', 'rabinmiller@gmail.com');
 
-select json_agg(json_build_object('name', name, 'email', email))
-			 from service.meeting_attendees
+CREATE OR REPLACE FUNCTION config.notify_change()
+ RETURNS trigger
+ LANGUAGE plpgsql
+AS $function$
+begin
+	perform pg_notify('config_changed', coalesce(new.code, old.code));
+	return null;
+end;
+$function$;
 
-select service.get_target_slot('2025-07-09T08:00:00Z')
+create trigger config_changed
+after insert or update or delete on config.config
+for each row execute function config.notify_change();
 
-			 
+-- Config is read row by row by LoadConfig in Go.
+drop function if exists config.get();
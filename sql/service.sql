@@ -19,50 +19,11 @@ create table service.meeting_time_slots (
   )
 );
 
-
-create or replace function service.get_free_slots(date_from timestamp with time zone, date_to timestamp with time zone)
-returns json
-language plpgsql
-as $function$
-declare
-	res json;
-begin  
-		with days as (
-			select * from service.get_days(now(), now() + interval '1 month')
-		),
-		slots as (
-			select 
-	    	d.date,
-		    s.time_start,
-	  	  (d.date + s.time_start) as slot_start,
-		    (d.date + s.time_start + s.duration) as slot_end
-	  	from days d
-		  join service.meeting_time_slots s
-	  	  on d.day_of_week = s.day_of_week
-		)
-		select json_agg(json_build_object(
-			'date', date,
-			'slots', slots
-		)) from (
-			select date, 
-				json_agg(
-					json_build_object(
-						'timeStart', slot_start, 
-						'timeEnd', slot_end
-					)
-				order by slot_start
-			) as slots
-		from slots
-		where slot_start > now()
-		group by date
-	)
-	into res;
-	return res;
-
-end;
-$function$;
-
-select service.get_free_slots(now(), now() + interval '1 month');
+-- Dates on which no slots are offered, e.g. holidays.
+create table service.blackout_dates (
+	date date primary key,
+	reason text
+);
 
 
 create or replace function service.get_days(from_date timestamp with time zone, to_date timestamp with time zone)
@@ -80,4 +41,52 @@ begin
     			 lower(trim(to_char(d, 'Day')))::service.day_of_week
 	  from generate_series(from_date, to_date, interval '1 day') d;
 end;
-$function$;
\ No newline at end of file
+$function$;
+
+create table service.meeting_types (
+	code text primary key,
+	name text not null
+);
+
+create type service.question_kind as enum ('text', 'select', 'checkbox', 'phone', 'url');
+
+create table service.meeting_questions (
+	id uuid primary key not null default gen_random_uuid(),
+	meeting_type text not null references service.meeting_types(code) on delete cascade,
+	code text not null,
+	label text not null,
+	kind service.question_kind not null,
+	required boolean not null default false,
+	options jsonb,
+	rules text,
+	sort_order int not null default 0,
+	unique (meeting_type, code)
+);
+
+create table service.bookings (
+	id uuid primary key not null default gen_random_uuid(),
+	create_time timestamptz default now() not null,
+	event_id text,
+	meeting_type text references service.meeting_types(code),
+	time_start timestamptz not null,
+	time_end timestamptz not null,
+	guest_email text not null,
+	guest_name text,
+	description text,
+	answers jsonb not null default '{}'
+);
+
+create type service.booking_status as enum ('confirmed', 'cancelled');
+
+alter table service.bookings add column status service.booking_status not null default 'confirmed';
+alter table service.bookings add column cancel_time timestamptz;
+alter table service.bookings add column cancel_reason text;
+
+create index bookings_time_start on service.bookings (time_start);
+create index bookings_guest_email on service.bookings (lower(guest_email));
+
+-- The JSON-returning functions were replaced by typed queries in Go.
+drop function if exists service.get_free_slots(timestamptz, timestamptz);
+drop function if exists service.get_target_slot(timestamptz);
+drop function if exists service.get_meeting_type(text);
+drop function if exists service.add_booking(json);